@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// drainTimeout is how long a bridge session waits for the other direction
+// once one direction of the session has ended.
+const drainTimeout = 500 * time.Millisecond
+
+// Bridge splices two endpoints given in socat-style address syntax. With
+// keep-open mode a listening first endpoint accepts connections until
+// interrupted, each with its own stream on the second endpoint.
+type Bridge struct {
+	config  config
+	first   endpoint
+	logger  *slog.Logger
+	mu      sync.Mutex
+	quit    chan interface{}
+	second  endpoint
+	streams map[io.Closer]struct{}
+}
+
+func (app *application) NewBridge(first, second endpoint) *Bridge {
+	return &Bridge{
+		config:  app.config,
+		first:   first,
+		logger:  app.logger,
+		quit:    make(chan interface{}),
+		second:  second,
+		streams: make(map[io.Closer]struct{}),
+	}
+}
+
+func (b *Bridge) StartBridge() error {
+	b.logger.Info("starting bridge", "first", b.first, "second", b.second)
+
+	go func() {
+		sigch := make(chan os.Signal, 1)
+		signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case s := <-sigch:
+			b.logger.Info("received operating system signal", "sig", s)
+			b.stopBridge()
+		case <-b.quit:
+			signal.Stop(sigch)
+		}
+	}()
+
+	// UDP-LISTEN serves a single peer, so it has no further streams to
+	// accept even in keep-open mode.
+	_, singlePeer := b.first.(*udpListenEndpoint)
+	keepOpen := b.config.keepOpen && isListening(b.first) && !singlePeer
+	for {
+		a, err := b.first.open()
+		if err != nil {
+			select {
+			case <-b.quit:
+				b.logger.Info("bridge shutdown successfully")
+				return nil
+			default:
+			}
+			b.stopBridge()
+			return err
+		}
+
+		if !keepOpen {
+			b.session(a)
+			break
+		}
+		go b.session(a)
+	}
+
+	b.stopBridge()
+	b.logger.Info("bridge shutdown successfully")
+	return nil
+}
+
+func (b *Bridge) stopBridge() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.quit:
+		return
+	default:
+	}
+
+	b.logger.Info("stopping bridge")
+	close(b.quit)
+	b.first.close()
+	b.second.close()
+	for s := range b.streams {
+		s.Close()
+	}
+}
+
+// session opens the second endpoint for a stream of the first one and
+// splices both streams.
+func (b *Bridge) session(a io.ReadWriteCloser) {
+	z, err := b.second.open()
+	if err != nil {
+		b.logger.Error("failed to open endpoint", "endpoint", b.second, "error", err)
+		a.Close()
+		return
+	}
+
+	if !b.track(a, z) {
+		a.Close()
+		z.Close()
+		return
+	}
+	defer b.untrack(a, z)
+
+	from, to := streamName(a, b.first), streamName(z, b.second)
+	b.logger.Info("bridging streams", "first", from, "second", to)
+
+	sent, rcvd := b.splice(a, z, from, to)
+	b.logger.Info("bridge session closed", "first", from, "second", to)
+	if b.config.verbose {
+		fmt.Printf("Session [%s] to [%s] closed: sent %d, rcvd %d\n", from, to, sent, rcvd)
+	}
+}
+
+// splice copies data both ways between two streams. When one direction
+// ends, the write side of its destination is shut down if possible and the
+// other direction gets drainTimeout to finish before both streams close.
+// It returns the bytes sent to and received from the first stream.
+func (b *Bridge) splice(a, z io.ReadWriteCloser, from, to string) (int, int) {
+	var mu sync.Mutex
+	var sent, rcvd int
+	count := func(n *int) func(int) {
+		return func(c int) {
+			mu.Lock()
+			*n += c
+			mu.Unlock()
+		}
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		b.config.pipe(z, a, from, to, count(&rcvd))
+		closeWrite(z)
+		done <- struct{}{}
+	}()
+	go func() {
+		b.config.pipe(a, z, to, from, count(&sent))
+		closeWrite(a)
+		done <- struct{}{}
+	}()
+
+	<-done
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+	}
+	a.Close()
+	z.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return sent, rcvd
+}
+
+func (b *Bridge) track(streams ...io.Closer) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.quit:
+		return false
+	default:
+	}
+	for _, s := range streams {
+		b.streams[s] = struct{}{}
+	}
+	return true
+}
+
+func (b *Bridge) untrack(streams ...io.Closer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range streams {
+		delete(b.streams, s)
+	}
+}
+
+// closeWrite shuts down the write side of streams that support it, such as
+// TCP connections and programs started by EXEC.
+func closeWrite(rwc io.ReadWriteCloser) {
+	if cw, ok := rwc.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
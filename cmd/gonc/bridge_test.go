@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBridgeTCPToUnix(t *testing.T) {
+	var wg sync.WaitGroup
+
+	sockPath := filepath.Join(t.TempDir(), "app.sock")
+	target, err := net.Listen("unix", sockPath)
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	logger, logBuf := createTestSlog()
+	app := &application{config: config{keepOpen: true}, logger: logger}
+
+	first, err := app.config.parseEndpoint("TCP-LISTEN:localhost:3073")
+	assert.NoError(t, err)
+	second, err := app.config.parseEndpoint("UNIX:" + sockPath)
+	assert.NoError(t, err)
+
+	b := app.NewBridge(first, second)
+	go func() {
+		err := b.StartBridge()
+		assert.NoError(t, err)
+	}()
+
+	var actual []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		for _, msg := range []string{"1st client\n", "2nd client\n"} {
+			conn, err := net.Dial("tcp", "localhost:3073")
+			assert.NoError(t, err)
+			fmt.Fprint(conn, msg)
+
+			reply, err := bufio.NewReader(conn).ReadString('\n')
+			assert.NoError(t, err)
+			actual = append(actual, reply)
+			conn.Close()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+	b.stopBridge()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting bridge"
+msg="bridging streams"
+msg="bridge session closed"
+msg="bridging streams"
+msg="bridge session closed"
+msg="stopping bridge"
+msg="bridge shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"1st client\n", "2nd client\n"}, actual)
+}
+
+func TestBridgeUDPToFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		keepOpen bool
+		addr     string
+	}{
+		{
+			name: "Single Peer",
+			addr: "127.0.0.1:7010",
+		},
+		{
+			name:     "Keep Open",
+			keepOpen: true,
+			addr:     "127.0.0.1:7018",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out")
+
+			logger, logBuf := createTestSlog()
+			app := &application{config: config{keepOpen: tt.keepOpen}, logger: logger}
+
+			first, err := app.config.parseEndpoint("UDP-LISTEN:" + tt.addr)
+			assert.NoError(t, err)
+			second, err := app.config.parseEndpoint("FILE:" + path)
+			assert.NoError(t, err)
+
+			b := app.NewBridge(first, second)
+			go func() {
+				err := b.StartBridge()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			conn, err := net.Dial("udp", tt.addr)
+			assert.NoError(t, err)
+			for _, msg := range []string{"1st datagram\n", "2nd datagram\n"} {
+				fmt.Fprint(conn, msg)
+				time.Sleep(50 * time.Millisecond)
+			}
+			conn.Close()
+
+			b.stopBridge()
+			time.Sleep(50 * time.Millisecond)
+
+			expected := `msg="starting bridge"
+msg="bridging streams"
+msg="stopping bridge"
+msg="bridge session closed"
+msg="bridge shutdown successfully"
+`
+			assert.Equal(t, expected, logBuf.String())
+
+			data, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, "1st datagram\n2nd datagram\n", string(data))
+		})
+	}
+}
+
+func TestBridgeEndpointRefused(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{config: config{}, logger: logger}
+
+	first, err := app.config.parseEndpoint("TCP:localhost:3074")
+	assert.NoError(t, err)
+	second, err := app.config.parseEndpoint("STDIO")
+	assert.NoError(t, err)
+
+	err = app.NewBridge(first, second).StartBridge()
+	assert.Error(t, err)
+
+	expected := `msg="starting bridge"
+msg="stopping bridge"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
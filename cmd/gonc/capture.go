@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// capture keeps the transcript of a run: the received data printed on the
+// standard output goes to the file of -o, and hex dumps of the traffic both
+// ways go to the file of --hex-file. It is shared by every session, and a
+// nil capture records nothing.
+type capture struct {
+	hex io.Writer
+	mu  sync.Mutex
+	now func() time.Time
+	out io.Writer
+}
+
+// openCapture creates the files given with -o and --hex-file. It returns nil
+// when neither is given.
+func openCapture(outFile, hexFile string) (*capture, error) {
+	if outFile == "" && hexFile == "" {
+		return nil, nil
+	}
+
+	c := &capture{now: time.Now}
+	if outFile != "" {
+		f, err := os.Create(outFile)
+		if err != nil {
+			return nil, err
+		}
+		c.out = f
+	}
+	if hexFile != "" {
+		f, err := os.Create(hexFile)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		c.hex = f
+	}
+	return c, nil
+}
+
+// close closes the capture files. Whatever is recorded afterwards is dropped.
+func (c *capture) close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, w := range []io.Writer{c.out, c.hex} {
+		if f, ok := w.(io.Closer); ok {
+			errs = append(errs, f.Close())
+		}
+	}
+	c.out, c.hex = nil, nil
+	return errors.Join(errs...)
+}
+
+// output copies received data, as printed, to the file of -o.
+func (c *capture) output(data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out != nil {
+		c.out.Write(data)
+	}
+}
+
+// dumpRecv writes a hex dump of data received from peer to the file of
+// --hex-file.
+func (c *capture) dumpRecv(peer any, data []byte) {
+	c.dump('<', peer, data)
+}
+
+// dumpSent writes a hex dump of data sent to peer to the file of --hex-file.
+func (c *capture) dumpSent(peer any, data []byte) {
+	c.dump('>', peer, data)
+}
+
+// dump writes a line with the time, the direction marker and the peer,
+// followed by the hex dump of data.
+func (c *capture) dump(marker byte, peer any, data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hex == nil {
+		return
+	}
+	fmt.Fprintf(c.hex, "%s %c %s %d bytes\n%s", c.now().Format("2006-01-02T15:04:05.000000Z07:00"), marker, peer, len(data), hex.Dump(data))
+}
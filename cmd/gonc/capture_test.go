@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	outFile := filepath.Join(dir, "session.out")
+	hexFile := filepath.Join(dir, "session.hex")
+
+	c, err := openCapture(outFile, hexFile)
+	assert.NoError(t, err)
+	c.now = func() time.Time { return time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC) }
+
+	peer := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8888}
+	c.output([]byte("hello\n"))
+	c.dumpRecv(peer, []byte("hello\n"))
+	c.dumpSent(peer, []byte("hi\n"))
+
+	data, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	expected := `2024-05-01T12:30:00.123456Z < 127.0.0.1:8888 6 bytes
+00000000  68 65 6c 6c 6f 0a                                 |hello.|
+2024-05-01T12:30:00.123456Z > 127.0.0.1:8888 3 bytes
+00000000  68 69 0a                                          |hi.|
+`
+	data, err = os.ReadFile(hexFile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(data))
+
+	// Once closed, the files are left as they are.
+	assert.NoError(t, c.close())
+	c.output([]byte("dropped"))
+	c.dumpRecv(peer, []byte("dropped"))
+	data, err = os.ReadFile(outFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	// Without files nothing is captured.
+	c, err = openCapture("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	c.output([]byte("dropped"))
+	c.dumpRecv(peer, []byte("dropped"))
+	assert.NoError(t, c.close())
+
+	_, err = openCapture(filepath.Join(dir, "missing", "session.out"), "")
+	assert.Error(t, err)
+	_, err = openCapture(outFile, filepath.Join(dir, "missing", "session.hex"))
+	assert.Error(t, err)
+}
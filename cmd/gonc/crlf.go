@@ -0,0 +1,82 @@
+package main
+
+import "io"
+
+// addCR returns data with every bare LF turned into CRLF, as sent with -C.
+// cr tells whether the byte before data was a CR and is updated for the next
+// chunk of the stream.
+func addCR(data []byte, cr *bool) []byte {
+	out := make([]byte, 0, len(data)+len(data)/8)
+	for _, b := range data {
+		if b == '\n' && !*cr {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+		*cr = b == '\r'
+	}
+	return out
+}
+
+// stripCR returns data with every CRLF turned into LF, as printed with
+// --crlf-recv. A CR ending data is held back in pending until the next chunk
+// of the stream shows whether an LF follows it. Datagrams, which stand on
+// their own, have no pending CR.
+func stripCR(data []byte, pending *bool) []byte {
+	out := make([]byte, 0, len(data)+1)
+	if pending != nil {
+		if *pending && (len(data) == 0 || data[0] != '\n') {
+			out = append(out, '\r')
+		}
+		*pending = false
+	}
+
+	for i, b := range data {
+		if b == '\r' {
+			last := i == len(data)-1
+			if last && pending != nil {
+				*pending = true
+				continue
+			}
+			if !last && data[i+1] == '\n' {
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// crlfWriter turns every bare LF written to it into CRLF.
+type crlfWriter struct {
+	w  io.Writer
+	cr bool
+}
+
+func (c *crlfWriter) Write(b []byte) (int, error) {
+	if _, err := c.w.Write(addCR(b, &c.cr)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// lfWriter turns every CRLF written to it into LF.
+type lfWriter struct {
+	w       io.Writer
+	pending bool
+}
+
+func (c *lfWriter) Write(b []byte) (int, error) {
+	if _, err := c.w.Write(stripCR(b, &c.pending)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// received returns data as printed, with CRLF turned into LF when
+// --crlf-recv is given. pending is nil for datagrams.
+func (cfg config) received(data []byte, pending *bool) []byte {
+	if !cfg.crlfRecv {
+		return data
+	}
+	return stripCR(data, pending)
+}
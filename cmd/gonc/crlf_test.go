@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddCR(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		expected string
+	}{
+		{name: "Bare LF", chunks: []string{"HELO x\nQUIT\n"}, expected: "HELO x\r\nQUIT\r\n"},
+		{name: "Already CRLF", chunks: []string{"PING\r\n"}, expected: "PING\r\n"},
+		{name: "CR Ends A Chunk", chunks: []string{"PING\r", "\nPONG\n"}, expected: "PING\r\nPONG\r\n"},
+		{name: "No Newline", chunks: []string{"partial"}, expected: "partial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cr bool
+			var actual strings.Builder
+			for _, chunk := range tt.chunks {
+				actual.Write(addCR([]byte(chunk), &cr))
+			}
+			assert.Equal(t, tt.expected, actual.String())
+		})
+	}
+}
+
+func TestStripCR(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []string
+		expected string
+	}{
+		{name: "CRLF", chunks: []string{"250 OK\r\n221 Bye\r\n"}, expected: "250 OK\n221 Bye\n"},
+		{name: "Bare CR Kept", chunks: []string{"50%\r75%\r\n"}, expected: "50%\r75%\n"},
+		{name: "CRLF Across Chunks", chunks: []string{"250 OK\r", "\n221 Bye\r\n"}, expected: "250 OK\n221 Bye\n"},
+		{name: "CR Across Chunks", chunks: []string{"50%\r", "75%\n"}, expected: "50%\r75%\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var actual strings.Builder
+			w := &lfWriter{w: &actual}
+			for _, chunk := range tt.chunks {
+				n, err := w.Write([]byte(chunk))
+				assert.NoError(t, err)
+				assert.Equal(t, len(chunk), n)
+			}
+			assert.Equal(t, tt.expected, actual.String())
+		})
+	}
+
+	// A datagram stands on its own, so a trailing CR is kept.
+	assert.Equal(t, "line\nend\r", string(stripCR([]byte("line\r\nend\r"), nil)))
+}
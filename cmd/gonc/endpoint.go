@@ -0,0 +1,530 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// endpoint is one side of a session in socat-style address syntax, such as
+// TCP:host:port or FILE:/tmp/out. The servers relay to endpoints and the
+// bridge splices two of them.
+type endpoint interface {
+	// open returns a new stream on the endpoint. Listening endpoints wait
+	// for the next inbound connection.
+	open() (io.ReadWriteCloser, error)
+	// close releases what the endpoint holds across streams, such as a
+	// listening socket.
+	close() error
+	String() string
+}
+
+var errSinglePeer = errors.New("UDP-LISTEN serves a single peer")
+
+// endpointKind splits an address specification into its upper-cased kind and
+// the rest, and reports whether the kind is one gonc knows.
+func endpointKind(spec string) (string, string, bool) {
+	if spec == "-" {
+		return "STDIO", "", true
+	}
+	kind, rest, _ := strings.Cut(spec, ":")
+	kind = strings.ToUpper(kind)
+
+	switch kind {
+	case "STDIO", "FILE", "PIPE", "EXEC", "SYSTEM",
+		"TCP", "TCP4", "TCP6", "TCP-LISTEN", "TCP4-LISTEN", "TCP6-LISTEN",
+		"UDP", "UDP4", "UDP6", "UDP-LISTEN", "UDP4-LISTEN", "UDP6-LISTEN",
+		"UNIX", "UNIX-LISTEN", "SSL", "SSL-LISTEN":
+		return kind, rest, true
+	}
+	return kind, rest, false
+}
+
+// parseEndpoint parses an address specification into an endpoint.
+func (cfg config) parseEndpoint(spec string) (endpoint, error) {
+	kind, rest, ok := endpointKind(spec)
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint kind %q", kind)
+	}
+	if rest == "" && kind != "STDIO" {
+		return nil, fmt.Errorf("missing address in endpoint %q", spec)
+	}
+
+	network := strings.ToLower(strings.TrimSuffix(kind, "-LISTEN"))
+	switch kind {
+	case "STDIO":
+		return stdioEndpoint{}, nil
+	case "FILE":
+		return fileEndpoint{path: rest}, nil
+	case "PIPE":
+		return pipeEndpoint{path: rest}, nil
+	case "EXEC":
+		return execEndpoint{command: rest}, nil
+	case "SYSTEM":
+		return execEndpoint{command: rest, shell: true}, nil
+	case "TCP", "TCP4", "TCP6", "UDP", "UDP4", "UDP6", "UNIX":
+		return &dialEndpoint{cfg: cfg, network: network, addr: rest}, nil
+	case "SSL":
+		return &dialEndpoint{cfg: cfg, network: "tcp", addr: rest, tls: true}, nil
+	case "TCP-LISTEN", "TCP4-LISTEN", "TCP6-LISTEN", "UNIX-LISTEN":
+		return &listenEndpoint{cfg: cfg, network: network, addr: listenAddr(network, rest)}, nil
+	case "SSL-LISTEN":
+		return &listenEndpoint{cfg: cfg, network: "tcp", addr: listenAddr("tcp", rest), tls: true}, nil
+	default:
+		return &udpListenEndpoint{cfg: cfg, network: network, addr: listenAddr(network, rest)}, nil
+	}
+}
+
+// relayEndpoint parses the --relay target of a listener. A plain host:port,
+// or a path in Unix socket mode, connects on the network of the listener.
+func (cfg config) relayEndpoint(proto string) (endpoint, error) {
+	if _, _, ok := endpointKind(cfg.relay); !ok {
+		return &dialEndpoint{cfg: cfg, network: cfg.network(proto), addr: cfg.relay}, nil
+	}
+
+	ep, err := cfg.parseEndpoint(cfg.relay)
+	if err != nil {
+		return nil, err
+	}
+	if isListening(ep) {
+		return nil, fmt.Errorf("cannot relay to listening endpoint %s", ep)
+	}
+	return ep, nil
+}
+
+// bridgeEndpoints parses the two addresses of a bridge. A FILE only takes
+// data in and never ends on its own, so it cannot be the first address.
+func (cfg config) bridgeEndpoints(first, second string) (endpoint, endpoint, error) {
+	a, err := cfg.parseEndpoint(first)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, ok := a.(fileEndpoint); ok {
+		return nil, nil, fmt.Errorf("%s is write-only and cannot be the first address", a)
+	}
+
+	z, err := cfg.parseEndpoint(second)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, z, nil
+}
+
+// listenAddr turns the address of a listening endpoint into a local address,
+// where a bare port listens on every interface.
+func listenAddr(network, addr string) string {
+	if network != "unix" && !strings.Contains(addr, ":") {
+		return ":" + addr
+	}
+	return addr
+}
+
+func isListening(ep endpoint) bool {
+	switch ep.(type) {
+	case *listenEndpoint, *udpListenEndpoint:
+		return true
+	}
+	return false
+}
+
+// dialEndpoint connects to a TCP, UDP or Unix socket, or to a TLS server.
+type dialEndpoint struct {
+	cfg     config
+	network string
+	addr    string
+	tls     bool
+}
+
+func (e *dialEndpoint) open() (io.ReadWriteCloser, error) {
+	conn, err := e.cfg.dial(e.network, e.addr)
+	if err != nil {
+		return nil, err
+	}
+	if e.cfg.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.RemoteAddr(), conn.LocalAddr(), conn.RemoteAddr().Network())
+	}
+	if !e.tls {
+		return conn, nil
+	}
+
+	host, _, _ := net.SplitHostPort(e.addr)
+	tlsConfig, err := e.cfg.clientTLSConfig(host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if e.cfg.verbose {
+		printTLSState(tlsConn.ConnectionState())
+	}
+	return tlsConn, nil
+}
+
+func (e *dialEndpoint) close() error { return nil }
+
+func (e *dialEndpoint) String() string {
+	kind := strings.ToUpper(e.network)
+	if e.tls {
+		kind = "SSL"
+	}
+	return kind + ":" + e.addr
+}
+
+// listenEndpoint accepts TCP, Unix or TLS connections. It starts listening
+// on the first call to open.
+type listenEndpoint struct {
+	cfg     config
+	network string
+	addr    string
+	tls     bool
+	mu      sync.Mutex
+	ln      net.Listener
+}
+
+func (e *listenEndpoint) open() (io.ReadWriteCloser, error) {
+	ln, err := e.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if e.cfg.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.LocalAddr(), conn.RemoteAddr(), conn.RemoteAddr().Network())
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if e.cfg.verbose {
+			printTLSState(tlsConn.ConnectionState())
+		}
+	}
+	return conn, nil
+}
+
+func (e *listenEndpoint) listen() (net.Listener, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ln != nil {
+		return e.ln, nil
+	}
+	ln, err := net.Listen(e.network, e.addr)
+	if err != nil {
+		return nil, err
+	}
+	if e.tls {
+		tlsConfig, err := e.cfg.serverTLSConfig()
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	if e.cfg.verbose {
+		fmt.Printf("Listening on %s...\n", formatListenAddr(ln.Addr()))
+	}
+	e.ln = ln
+	return ln, nil
+}
+
+func (e *listenEndpoint) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ln == nil {
+		return nil
+	}
+	return e.ln.Close()
+}
+
+func (e *listenEndpoint) String() string {
+	kind := strings.ToUpper(e.network)
+	if e.tls {
+		kind = "SSL"
+	}
+	return kind + "-LISTEN:" + e.addr
+}
+
+// udpListenEndpoint waits for the first datagram on a UDP socket and then
+// exchanges datagrams with its sender only.
+type udpListenEndpoint struct {
+	cfg     config
+	network string
+	addr    string
+	mu      sync.Mutex
+	ln      net.PacketConn
+}
+
+func (e *udpListenEndpoint) open() (io.ReadWriteCloser, error) {
+	e.mu.Lock()
+	if e.ln != nil {
+		e.mu.Unlock()
+		return nil, errSinglePeer
+	}
+	ln, err := net.ListenPacket(e.network, e.addr)
+	if err != nil {
+		e.mu.Unlock()
+		return nil, err
+	}
+	e.ln = ln
+	e.mu.Unlock()
+
+	if e.cfg.verbose {
+		fmt.Printf("Listening on %s ...\n", formatListenAddr(ln.LocalAddr()))
+	}
+
+	buf := make([]byte, 64*1024)
+	n, rAddr, err := ln.ReadFrom(buf)
+	if err != nil {
+		return nil, err
+	}
+	if rAddr == nil {
+		return nil, errUnboundPeer
+	}
+	if e.cfg.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", ln.LocalAddr(), rAddr, rAddr.Network())
+	}
+	return &pendingConn{Conn: &peerConn{PacketConn: ln, rAddr: rAddr}, pending: buf[:n]}, nil
+}
+
+func (e *udpListenEndpoint) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.ln == nil {
+		return nil
+	}
+	return e.ln.Close()
+}
+
+func (e *udpListenEndpoint) String() string {
+	return strings.ToUpper(e.network) + "-LISTEN:" + e.addr
+}
+
+// pendingConn returns a datagram that was already read before reading from
+// its connection.
+type pendingConn struct {
+	net.Conn
+	pending []byte
+}
+
+func (c *pendingConn) Read(b []byte) (int, error) {
+	if c.pending != nil {
+		n := copy(b, c.pending)
+		c.pending = nil
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// stdioEndpoint reads the standard input and writes the standard output.
+type stdioEndpoint struct{}
+
+func (stdioEndpoint) open() (io.ReadWriteCloser, error) { return stdioStream{}, nil }
+func (stdioEndpoint) close() error                      { return nil }
+func (stdioEndpoint) String() string                    { return "STDIO" }
+
+// stdioStream leaves the standard streams open when closed, so that later
+// sessions can still use them.
+type stdioStream struct{}
+
+func (stdioStream) Read(b []byte) (int, error)  { return os.Stdin.Read(b) }
+func (stdioStream) Write(b []byte) (int, error) { return os.Stdout.Write(b) }
+func (stdioStream) Close() error                { return nil }
+
+// fileEndpoint appends everything it receives to a file. Nothing is read
+// from the file, so the session lasts until the other side ends it.
+type fileEndpoint struct {
+	path string
+}
+
+func (e fileEndpoint) open() (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(e.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{f: f, done: make(chan struct{})}, nil
+}
+
+func (e fileEndpoint) close() error   { return nil }
+func (e fileEndpoint) String() string { return "FILE:" + e.path }
+
+type fileSink struct {
+	f    *os.File
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *fileSink) Read(b []byte) (int, error) {
+	<-s.done
+	return 0, io.EOF
+}
+
+func (s *fileSink) Write(b []byte) (int, error) { return s.f.Write(b) }
+
+func (s *fileSink) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.f.Close()
+}
+
+// pipeEndpoint reads and writes a named pipe, creating it when missing. It is
+// opened for both reading and writing so that opening never blocks and the
+// pipe does not end when its other users come and go.
+type pipeEndpoint struct {
+	path string
+}
+
+func (e pipeEndpoint) open() (io.ReadWriteCloser, error) {
+	if err := mkfifo(e.path); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, &os.PathError{Op: "mkfifo", Path: e.path, Err: err}
+	}
+	return os.OpenFile(e.path, os.O_RDWR, 0)
+}
+
+func (e pipeEndpoint) close() error   { return nil }
+func (e pipeEndpoint) String() string { return "PIPE:" + e.path }
+
+// execEndpoint starts a program for every stream, writing to its standard
+// input and reading its standard output. Shell commands run with /bin/sh.
+// Standard error goes where stderr says, as for --exec-stderr.
+type execEndpoint struct {
+	command string
+	env     []string
+	shell   bool
+	stderr  string
+}
+
+func (e execEndpoint) open() (io.ReadWriteCloser, error) {
+	c := exec.Command("/bin/sh", "-c", e.command)
+	if !e.shell {
+		var err error
+		if c, err = parseCommand(e.command); err != nil {
+			return nil, err
+		}
+	}
+	c.Env = e.env
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// The output is read from a pipe of our own, so that reaping the
+	// program does not close it before everything has been read.
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, closeStderr, err := commandStderr(e.stderr, w)
+	if err != nil {
+		stdout.Close()
+		w.Close()
+		return nil, err
+	}
+	c.Stdout = w
+	c.Stderr = stderr
+
+	err = c.Start()
+	w.Close()
+	if err != nil {
+		stdout.Close()
+		closeStderr()
+		return nil, err
+	}
+
+	s := &execStream{cmd: c, stdin: stdin, stdout: stdout, exited: make(chan struct{})}
+	go func() {
+		c.Wait()
+		closeStderr()
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+func (e execEndpoint) close() error { return nil }
+
+func (e execEndpoint) String() string {
+	if e.shell {
+		return "SYSTEM:" + e.command
+	}
+	return "EXEC:" + e.command
+}
+
+type execStream struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	once   sync.Once
+}
+
+func (s *execStream) Read(b []byte) (int, error)  { return s.stdout.Read(b) }
+func (s *execStream) Write(b []byte) (int, error) { return s.stdin.Write(b) }
+
+// CloseWrite closes the standard input of the program, which lets it finish
+// its output.
+func (s *execStream) CloseWrite() error { return s.stdin.Close() }
+
+// Close stops the program if it is still running and reaps it.
+func (s *execStream) Close() error {
+	s.once.Do(func() {
+		s.stdin.Close()
+		s.cmd.Process.Kill()
+		<-s.exited
+		s.stdout.Close()
+	})
+	return nil
+}
+
+// pipe copies src to dst, calling count with the size of every chunk copied.
+// In hex mode every chunk is dumped along with the direction it travelled.
+// It returns the error that ended the copy, or nil at the end of src.
+func (cfg config) pipe(dst io.Writer, src io.Reader, from, to any, count func(int)) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			cfg.capture.dumpRecv(from, buf[:n])
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			count(n)
+			cfg.capture.dumpSent(to, buf[:n])
+
+			if cfg.hex {
+				fmt.Printf("Relayed %d bytes from [%s] to [%s]\n%s", n, from, to, hex.Dump(buf[:n]))
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamName names a stream opened on an endpoint for logs and dumps: the
+// remote address of a connection, or the endpoint itself.
+func streamName(rwc io.ReadWriteCloser, ep endpoint) string {
+	if conn, ok := rwc.(net.Conn); ok && conn.RemoteAddr() != nil {
+		return conn.RemoteAddr().String()
+	}
+	return ep.String()
+}
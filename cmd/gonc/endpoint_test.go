@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expected    string
+		listening   bool
+		expectedErr string
+	}{
+		{spec: "TCP:localhost:80", expected: "TCP:localhost:80"},
+		{spec: "tcp6:[::1]:80", expected: "TCP6:[::1]:80"},
+		{spec: "TCP-LISTEN:8080", expected: "TCP-LISTEN::8080", listening: true},
+		{spec: "TCP-LISTEN:127.0.0.1:8080", expected: "TCP-LISTEN:127.0.0.1:8080", listening: true},
+		{spec: "UDP:host:53", expected: "UDP:host:53"},
+		{spec: "UDP-LISTEN:5353", expected: "UDP-LISTEN::5353", listening: true},
+		{spec: "UNIX:/run/app.sock", expected: "UNIX:/run/app.sock"},
+		{spec: "UNIX-LISTEN:/tmp/gonc.sock", expected: "UNIX-LISTEN:/tmp/gonc.sock", listening: true},
+		{spec: "SSL:example.com:443", expected: "SSL:example.com:443"},
+		{spec: "SSL-LISTEN:8443", expected: "SSL-LISTEN::8443", listening: true},
+		{spec: "FILE:/tmp/out", expected: "FILE:/tmp/out"},
+		{spec: "PIPE:/tmp/fifo", expected: "PIPE:/tmp/fifo"},
+		{spec: "EXEC:cat -n", expected: "EXEC:cat -n"},
+		{spec: "SYSTEM:cat | wc -l", expected: "SYSTEM:cat | wc -l"},
+		{spec: "STDIO", expected: "STDIO"},
+		{spec: "-", expected: "STDIO"},
+		{spec: "TCP:", expectedErr: `missing address in endpoint "TCP:"`},
+		{spec: "HTTP:example.com:80", expectedErr: `unknown endpoint kind "HTTP"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			ep, err := config{}.parseEndpoint(tt.spec)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ep.String())
+			assert.Equal(t, tt.listening, isListening(ep))
+		})
+	}
+}
+
+func TestRelayEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      config
+		proto       string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "Plain TCP Address",
+			config:   config{relay: "backend:80"},
+			proto:    "tcp",
+			expected: "TCP:backend:80",
+		},
+		{
+			name:     "Plain UDP Address",
+			config:   config{relay: "backend:53", ipv4: true},
+			proto:    "udp",
+			expected: "UDP4:backend:53",
+		},
+		{
+			name:     "Unix Socket Path",
+			config:   config{relay: "/run/app.sock", unix: true},
+			proto:    "tcp",
+			expected: "UNIX:/run/app.sock",
+		},
+		{
+			name:     "Endpoint Specification",
+			config:   config{relay: "EXEC:cat"},
+			proto:    "tcp",
+			expected: "EXEC:cat",
+		},
+		{
+			name:        "Listening Endpoint",
+			config:      config{relay: "TCP-LISTEN:8080"},
+			proto:       "tcp",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep, err := tt.config.relayEndpoint(tt.proto)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ep.String())
+		})
+	}
+}
+
+func TestBridgeEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		first       string
+		second      string
+		expectedErr bool
+	}{
+		{
+			name:   "Listener To File",
+			first:  "UDP-LISTEN:127.0.0.1:5353",
+			second: "FILE:/tmp/queries",
+		},
+		{
+			name:        "File First",
+			first:       "FILE:/etc/hosts",
+			second:      "TCP:localhost:80",
+			expectedErr: true,
+		},
+		{
+			name:        "Unknown Kind",
+			first:       "STDIO",
+			second:      "SCTP:localhost:80",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second, err := config{}.bridgeEndpoints(tt.first, tt.second)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.first, first.String())
+			assert.Equal(t, tt.second, second.String())
+		})
+	}
+}
+
+func TestFileEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	ep, err := config{}.parseEndpoint("FILE:" + path)
+	assert.NoError(t, err)
+
+	for _, msg := range []string{"1st line\n", "2nd line\n"} {
+		s, err := ep.open()
+		assert.NoError(t, err)
+		_, err = io.WriteString(s, msg)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Close())
+
+		// Reads only end once the stream is closed.
+		_, err = s.Read(make([]byte, 16))
+		assert.Equal(t, io.EOF, err)
+	}
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "1st line\n2nd line\n", string(data))
+}
+
+func TestExecEndpoint(t *testing.T) {
+	ep, err := config{}.parseEndpoint("EXEC:cat -n")
+	assert.NoError(t, err)
+
+	s, err := ep.open()
+	assert.NoError(t, err)
+	defer s.Close()
+
+	fmt.Fprintln(s, "hello")
+	closeWrite(s)
+
+	data, err := io.ReadAll(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "     1\thello\n", string(data))
+}
+
+func TestUDPListenEndpoint(t *testing.T) {
+	ep, err := config{}.parseEndpoint("UDP-LISTEN:127.0.0.1:7009")
+	assert.NoError(t, err)
+	defer ep.close()
+
+	opened := make(chan io.ReadWriteCloser)
+	go func() {
+		s, err := ep.open()
+		assert.NoError(t, err)
+		opened <- s
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	conn, err := net.Dial("udp", "127.0.0.1:7009")
+	assert.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintln(conn, "1st datagram")
+	s := <-opened
+
+	msg, err := bufio.NewReader(s).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "1st datagram\n", msg)
+
+	fmt.Fprintln(s, "reply")
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "reply\n", string(buf[:n]))
+
+	_, err = ep.open()
+	assert.Equal(t, errSinglePeer, err)
+}
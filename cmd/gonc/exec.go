@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// command builds the process to run for a connection: the program given
+// with -e and its arguments, or the command line given with -c run by
+// /bin/sh.
+func (cfg config) command() (*exec.Cmd, error) {
+	if cfg.shExec != "" {
+		return exec.Command("/bin/sh", "-c", cfg.shExec), nil
+	}
+	return parseCommand(cfg.cmd)
+}
+
+// commandEndpoint returns the process given with -e or -c as an endpoint,
+// which starts a new process for every stream.
+func (cfg config) commandEndpoint() execEndpoint {
+	if cfg.shExec != "" {
+		return execEndpoint{command: cfg.shExec, shell: true, stderr: cfg.execStderr}
+	}
+	return execEndpoint{command: cfg.cmd, stderr: cfg.execStderr}
+}
+
+// executes reports whether connections are handed to a process given with
+// -e or -c.
+func (cfg config) executes() bool {
+	return cfg.cmd != "" || cfg.shExec != ""
+}
+
+// commandEnv returns the environment of a process run for a connection: the
+// environment of gonc plus GONC_* variables describing the connection, like
+// the NCAT_* variables of ncat.
+func commandEnv(local, remote net.Addr) []string {
+	lHost, lPort := splitAddr(local)
+	rHost, rPort := splitAddr(remote)
+	return append(os.Environ(),
+		"GONC_REMOTE_ADDR="+rHost,
+		"GONC_REMOTE_PORT="+rPort,
+		"GONC_LOCAL_ADDR="+lHost,
+		"GONC_LOCAL_PORT="+lPort,
+		"GONC_PROTO="+remote.Network(),
+	)
+}
+
+// splitAddr splits an address into host and port. Unix socket addresses
+// have no port.
+func splitAddr(addr net.Addr) (string, string) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String(), ""
+	}
+	return host, port
+}
+
+// runCommand runs c with its standard input and output connected to rw and
+// its standard error sent where --exec-stderr says. It returns once the
+// process exits, without waiting for more data from rw. With --pty the
+// process runs in a pseudo-terminal connected to rw instead.
+func (cfg config) runCommand(c *exec.Cmd, rw io.ReadWriter) error {
+	stderr, closeStderr, err := commandStderr(cfg.execStderr, rw)
+	if err != nil {
+		return err
+	}
+	defer closeStderr()
+
+	if cfg.pty {
+		if cfg.execStderr == "socket" {
+			stderr = nil
+		}
+		return runPTY(c, rw, stderr)
+	}
+
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return err
+	}
+	c.Stdout = rw
+	c.Stderr = stderr
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go func() {
+		io.Copy(stdin, rw)
+		stdin.Close()
+	}()
+	return c.Wait()
+}
+
+// commandStderr returns where the standard error of a process goes for an
+// --exec-stderr mode: "socket" merges it into the output sent to the peer,
+// "console" (or no mode) is the standard error of gonc and anything else is
+// a file appended to. The returned function closes the file, if any.
+func commandStderr(mode string, socket io.Writer) (io.Writer, func(), error) {
+	switch mode {
+	case "socket":
+		return socket, func() {}, nil
+	case "", "console":
+		return os.Stderr, func() {}, nil
+	}
+
+	f, err := os.OpenFile(mode, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() { f.Close() }, nil
+}
+
+// reportExit logs how a process run for a connection ended, with args
+// describing the connection. A process exiting with a non-zero status is
+// reported like any other exit; only a process that could not run is an
+// error.
+func (cfg config) reportExit(logger *slog.Logger, c *exec.Cmd, err error, args ...any) {
+	if c == nil || c.ProcessState == nil {
+		logger.Error("failed to run command", append(args, "error", err)...)
+		return
+	}
+
+	logger.Info("command exited", append(args, "code", c.ProcessState.ExitCode())...)
+	if cfg.verbose {
+		fmt.Printf("Command exited: %s\n", c.ProcessState)
+	}
+}
+
+// parseCommand splits a command line into a program and its arguments.
+func parseCommand(line string) (*exec.Cmd, error) {
+	args, err := splitCommand(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("missing program")
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// splitCommand splits a command line into words, honouring single quotes,
+// double quotes and backslash escapes like a POSIX shell. Nothing else is
+// expanded.
+func splitCommand(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]):
+				i++
+				word.WriteRune(runes[i])
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash in command")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
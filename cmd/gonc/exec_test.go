@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		line        string
+		expected    []string
+		expectedErr string
+	}{
+		{line: "/bin/cat", expected: []string{"/bin/cat"}},
+		{line: "/bin/cat -n", expected: []string{"/bin/cat", "-n"}},
+		{line: "  grep   -i  foo\t", expected: []string{"grep", "-i", "foo"}},
+		{line: `echo 'hello world'`, expected: []string{"echo", "hello world"}},
+		{line: `echo "say \"hi\" to $USER"`, expected: []string{"echo", `say "hi" to $USER`}},
+		{line: `echo "a\b"`, expected: []string{"echo", `a\b`}},
+		{line: `echo it\'s a\ b`, expected: []string{"echo", "it's", "a b"}},
+		{line: `echo '' x`, expected: []string{"echo", "", "x"}},
+		{line: `printf '%s'"-"x`, expected: []string{"printf", "%s-x"}},
+		{line: "", expected: nil},
+		{line: `echo 'open`, expectedErr: "unterminated ' quote in command"},
+		{line: `echo "open`, expectedErr: `unterminated " quote in command`},
+		{line: `echo \`, expectedErr: "trailing backslash in command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			actual, err := splitCommand(tt.line)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      config
+		expected    []string
+		expectedErr bool
+	}{
+		{
+			name:     "Program With Arguments",
+			config:   config{cmd: `/bin/cat -n`},
+			expected: []string{"/bin/cat", "-n"},
+		},
+		{
+			name:     "Shell Command",
+			config:   config{shExec: `cat -n | tr a-z A-Z`},
+			expected: []string{"/bin/sh", "-c", "cat -n | tr a-z A-Z"},
+		},
+		{
+			name:        "Missing Program",
+			config:      config{cmd: " "},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := tt.config.command()
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, c.Args)
+		})
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    net.Addr
+		remote   net.Addr
+		expected []string
+	}{
+		{
+			name:   "TCP",
+			local:  &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8888},
+			remote: &net.TCPAddr{IP: net.ParseIP("::1"), Port: 52168},
+			expected: []string{
+				"GONC_REMOTE_ADDR=::1",
+				"GONC_REMOTE_PORT=52168",
+				"GONC_LOCAL_ADDR=127.0.0.1",
+				"GONC_LOCAL_PORT=8888",
+				"GONC_PROTO=tcp",
+			},
+		},
+		{
+			name:   "Unix Datagram",
+			local:  &net.UnixAddr{Name: "/tmp/gonc.sock", Net: "unixgram"},
+			remote: &net.UnixAddr{Name: "/tmp/client.sock", Net: "unixgram"},
+			expected: []string{
+				"GONC_REMOTE_ADDR=/tmp/client.sock",
+				"GONC_REMOTE_PORT=",
+				"GONC_LOCAL_ADDR=/tmp/gonc.sock",
+				"GONC_LOCAL_PORT=",
+				"GONC_PROTO=unixgram",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := commandEnv(tt.local, tt.remote)
+			assert.Equal(t, os.Environ(), env[:len(env)-5])
+			assert.Equal(t, tt.expected, env[len(env)-5:])
+		})
+	}
+}
+
+func TestCommandStderr(t *testing.T) {
+	var socket strings.Builder
+	path := filepath.Join(t.TempDir(), "stderr.log")
+
+	w, closeStderr, err := commandStderr("socket", &socket)
+	assert.NoError(t, err)
+	assert.Equal(t, &socket, w)
+	closeStderr()
+
+	w, closeStderr, err = commandStderr("console", &socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Stderr, w)
+	closeStderr()
+
+	for _, line := range []string{"1st\n", "2nd\n"} {
+		w, closeStderr, err = commandStderr(path, &socket)
+		assert.NoError(t, err)
+		fmt.Fprint(w, line)
+		closeStderr()
+	}
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "1st\n2nd\n", string(data))
+
+	_, _, err = commandStderr(filepath.Join(path, "missing"), &socket)
+	assert.Error(t, err)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func mkfifo(path string) error {
+	return errors.New("named pipes are not supported on this platform")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// serveHTTPConnect answers a single HTTP CONNECT request on a client session
+// and splices the client with the requested target.
+func (srv *TCPServer) serveHTTPConnect(s *tcpSession) {
+	conn := s.conn
+	r := bufio.NewReader(conn)
+
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		srv.logger.Error("failed to read HTTP proxy request", "remoteAddr", conn.RemoteAddr(), "error", err)
+		srv.closeSession(s)
+		return
+	}
+	req.Body.Close()
+
+	target := req.Host
+	srv.logger.Info("HTTP proxy request", "remoteAddr", conn.RemoteAddr(), "method", req.Method, "target", target)
+
+	if req.Method != http.MethodConnect {
+		writeHTTPStatus(conn, http.StatusMethodNotAllowed, "Allow: CONNECT\r\n")
+		srv.closeSession(s)
+		return
+	}
+
+	if srv.config.proxyAuth != "" && !checkBasicAuth(req.Header.Get("Proxy-Authorization"), srv.config.proxyAuth) {
+		srv.logger.Error("HTTP proxy authentication failed", "remoteAddr", conn.RemoteAddr())
+		writeHTTPStatus(conn, http.StatusProxyAuthRequired, "Proxy-Authenticate: Basic realm=\"gonc\"\r\n")
+		srv.closeSession(s)
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		writeHTTPStatus(conn, http.StatusBadRequest, "")
+		srv.closeSession(s)
+		return
+	}
+
+	addrs, err := srv.checkTarget(target)
+	if errors.Is(err, errTargetDenied) {
+		srv.logger.Error("proxy target not allowed", "remoteAddr", conn.RemoteAddr(), "target", target)
+		writeHTTPStatus(conn, http.StatusForbidden, "")
+		srv.closeSession(s)
+		return
+	}
+	if err != nil {
+		srv.logger.Error("failed to resolve HTTP proxy target", "target", target, "error", err)
+		writeHTTPStatus(conn, http.StatusBadGateway, "")
+		srv.closeSession(s)
+		return
+	}
+
+	if srv.config.verbose {
+		fmt.Printf("HTTP CONNECT to [%s] from [%s]\n", target, conn.RemoteAddr())
+	}
+
+	upstream, err := srv.dialTarget(addrs)
+	if err != nil {
+		srv.logger.Error("failed to connect to HTTP proxy target", "target", target, "error", err)
+		writeHTTPStatus(conn, http.StatusBadGateway, "")
+		srv.closeSession(s)
+		return
+	}
+
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		upstream.Close()
+		srv.closeSession(s)
+		return
+	}
+
+	if r.Buffered() > 0 {
+		s.conn = &bufferedConn{Conn: conn, r: r}
+	}
+	srv.splice(s, upstream, target)
+}
+
+// errTargetDenied is returned for proxy targets refused by --proxy-deny or
+// --proxy-allow.
+var errTargetDenied = errors.New("proxy target not allowed")
+
+// checkTarget checks a proxy target against the --proxy-deny and
+// --proxy-allow lists and returns the addresses to connect to. Denied targets
+// win, and with an allow list only the targets it matches are allowed. Host
+// names are resolved so that every address they stand for is checked too,
+// and the checked addresses are returned so that the name is not looked up
+// again when connecting.
+func (srv *TCPServer) checkTarget(target string) ([]string, error) {
+	deny, allow := srv.config.proxyDeny, srv.config.proxyAllow
+	if len(deny) == 0 && len(allow) == 0 {
+		return []string{target}, nil
+	}
+	if matchesAny(deny, target) {
+		return nil, errTargetDenied
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	network := "ip"
+	switch {
+	case srv.config.ipv4:
+		network = "ip4"
+	case srv.config.ipv6:
+		network = "ip6"
+	}
+	ips, err := net.DefaultResolver.LookupIP(context.Background(), network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.JoinHostPort(ip.String(), port)
+		if matchesAny(deny, addrs[i]) {
+			return nil, errTargetDenied
+		}
+	}
+
+	if len(allow) == 0 || matchesAny(allow, target) {
+		return addrs, nil
+	}
+	for _, addr := range addrs {
+		if !matchesAny(allow, addr) {
+			return nil, errTargetDenied
+		}
+	}
+	return addrs, nil
+}
+
+// matchesAny reports whether a host:port target matches any of patterns.
+func matchesAny(patterns []string, target string) bool {
+	for _, pattern := range patterns {
+		if targetMatches(pattern, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetMatches reports whether a host:port target matches a pattern. A
+// pattern is a host name, an IP address or a CIDR block, optionally followed
+// by a port. Host names starting with "*." match any subdomain.
+func targetMatches(pattern, target string) bool {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+
+	pHost, pPort, err := net.SplitHostPort(pattern)
+	if err != nil {
+		pHost, pPort = pattern, ""
+	}
+	if pPort != "" && pPort != port {
+		return false
+	}
+
+	if _, ipNet, err := net.ParseCIDR(pHost); err == nil {
+		ip := net.ParseIP(host)
+		return ip != nil && ipNet.Contains(ip)
+	}
+
+	host = strings.ToLower(host)
+	pHost = strings.ToLower(pHost)
+	if suffix, ok := strings.CutPrefix(pHost, "*"); ok {
+		return strings.HasSuffix(host, suffix)
+	}
+	return host == pHost
+}
+
+// checkBasicAuth reports whether a Basic authorization header carries the
+// expected user:password credentials.
+func checkBasicAuth(header, credentials string) bool {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return string(decoded) == credentials
+}
+
+func writeHTTPStatus(w io.Writer, code int, headers string) error {
+	_, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n%sContent-Length: 0\r\n\r\n", code, http.StatusText(code), headers)
+	return err
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPProxyServer(t *testing.T) {
+	tests := []struct {
+		name        string
+		port        string
+		config      config
+		clientAuth  string
+		target      string
+		expectedErr string
+	}{
+		{
+			name:   "Connect",
+			port:   "3060",
+			config: config{},
+			target: "localhost:3069",
+		},
+		{
+			name:       "Connect With Authentication",
+			port:       "3061",
+			config:     config{proxyAuth: "user:secret"},
+			clientAuth: "user:secret",
+			target:     "localhost:3069",
+		},
+		{
+			name:        "Missing Credentials",
+			port:        "3062",
+			config:      config{proxyAuth: "user:secret"},
+			target:      "localhost:3069",
+			expectedErr: "407 Proxy Authentication Required",
+		},
+		{
+			name:   "Allowed Target",
+			port:   "3063",
+			config: config{proxyAllow: []string{"example.com", "localhost:3069"}},
+			target: "localhost:3069",
+		},
+		{
+			name:        "Target Not In Allow List",
+			port:        "3064",
+			config:      config{proxyAllow: []string{"localhost:80"}},
+			target:      "localhost:3069",
+			expectedErr: "403 Forbidden",
+		},
+		{
+			name:        "Denied Target",
+			port:        "3065",
+			config:      config{proxyAllow: []string{"localhost"}, proxyDeny: []string{"127.0.0.0/8"}},
+			target:      "127.0.0.1:3069",
+			expectedErr: "403 Forbidden",
+		},
+		{
+			name:        "Denied Host Name",
+			port:        "3097",
+			config:      config{proxyDeny: []string{"127.0.0.0/8", "::1/128"}},
+			target:      "localhost:3069",
+			expectedErr: "403 Forbidden",
+		},
+		{
+			name:        "Target Refused",
+			port:        "3066",
+			config:      config{},
+			target:      "localhost:3068",
+			expectedErr: "502 Bad Gateway",
+		},
+	}
+
+	target, err := net.Listen("tcp", "localhost:3069")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := createTestSlog()
+
+			cfg := tt.config
+			cfg.httpProxyServer = true
+			cfg.keepOpen = true
+			app := &application{config: cfg, logger: logger}
+
+			srv := app.NewTCPServer("localhost:" + tt.port)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			defer srv.stopTCP()
+
+			clientCfg := config{proxy: "localhost:" + tt.port, proxyType: "http", proxyAuth: tt.clientAuth}
+			conn, err := clientCfg.dial("tcp", tt.target)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			fmt.Fprintln(conn, "hello through the proxy")
+			msg, err := bufio.NewReader(conn).ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "hello through the proxy\n", msg)
+		})
+	}
+}
+
+func TestHTTPProxyServerLogs(t *testing.T) {
+	target, err := net.Listen("tcp", "localhost:3067")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		conn, err := target.Accept()
+		if err == nil {
+			fmt.Fprintln(conn, "hello from the target")
+			conn.Close()
+		}
+	}()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{httpProxyServer: true, keepOpen: true},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("localhost:3070")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:3070")
+	assert.NoError(t, err)
+	fmt.Fprint(conn, "CONNECT localhost:3067 HTTP/1.1\r\nHost: localhost:3067\r\n\r\n")
+
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 Connection established\r\n\r\nhello from the target\n", string(data))
+
+	time.Sleep(50 * time.Millisecond)
+	srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="HTTP proxy request"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestHTTPProxyServerSourceAddress(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:3095")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		conn, err := target.Accept()
+		if err == nil {
+			fmt.Fprintln(conn, conn.RemoteAddr().(*net.TCPAddr).IP)
+			conn.Close()
+		}
+	}()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{httpProxyServer: true, keepOpen: true, source: "127.0.0.2"},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3096")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	defer srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:3096")
+	assert.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "CONNECT 127.0.0.1:3095 HTTP/1.1\r\nHost: 127.0.0.1:3095\r\n\r\n")
+
+	// The target sees the proxy connect from the address given with -s.
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 Connection established\r\n\r\n127.0.0.2\n", string(data))
+}
+
+func TestTargetMatches(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		target   string
+		expected bool
+	}{
+		{"example.com", "example.com:443", true},
+		{"example.com", "EXAMPLE.com:80", true},
+		{"example.com:443", "example.com:80", false},
+		{"*.example.com", "api.example.com:443", true},
+		{"*.example.com", "example.com:443", false},
+		{"10.0.0.0/8", "10.1.2.3:22", true},
+		{"10.0.0.0/8", "192.168.1.1:22", false},
+		{"10.0.0.0/8", "example.com:22", false},
+		{"[::1]:8080", "[::1]:8080", true},
+		{"::1", "[::1]:8080", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.target, func(t *testing.T) {
+			assert.Equal(t, tt.expected, targetMatches(tt.pattern, tt.target))
+		})
+	}
+}
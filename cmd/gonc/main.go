@@ -3,24 +3,70 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
 type config struct {
-	cmd     string
-	debug   bool
-	hex     bool
-	listen  bool
-	port    int
-	udp     bool
-	verbose bool
-	zero    string
+	broker          bool
+	capture         *capture
+	cmd             string
+	crlf            bool
+	crlfRecv        bool
+	debug           bool
+	execStderr      string
+	halfClose       bool
+	hex             bool
+	hexFile         string
+	httpProxyServer bool
+	idleTimeout     time.Duration
+	ipv4            bool
+	ipv6            bool
+	keepOpen        bool
+	lineMode        bool
+	listen          bool
+	outFile         string
+	peerTimeout     time.Duration
+	port            int
+	proxy           string
+	proxyAllow      []string
+	proxyAuth       string
+	proxyDeny       []string
+	proxyType       string
+	pty             bool
+	quitDelay       int
+	relay           string
+	replyAll        bool
+	shExec          string
+	source          string
+	socksServer     bool
+	ssl             bool
+	sslALPN         string
+	sslAllow        []string
+	sslCert         string
+	sslClientCA     string
+	sslKey          string
+	sslServerName   string
+	sslTrustFile    string
+	sslVerify       bool
+	udp             bool
+	unix            bool
+	verbose         bool
+	wait            int
+	zero            string
 }
 
+var errUnboundPeer = errors.New("peer has no address to reply to")
+
 type application struct {
 	config config
 	logger *slog.Logger
@@ -29,14 +75,51 @@ type application struct {
 func main() {
 	var cfg config
 
+	pflag.BoolVar(&cfg.broker, "broker", false, "relay data between all connected clients in listen mode")
+	pflag.BoolVarP(&cfg.crlf, "crlf", "C", false, "send line endings as CRLF")
+	pflag.BoolVar(&cfg.crlfRecv, "crlf-recv", false, "turn received CRLF line endings into LF")
 	pflag.BoolVarP(&cfg.debug, "debug", "d", false, "debug mode for logs")
+	pflag.BoolVarP(&cfg.halfClose, "half-close", "N", false, "shut down the write side of the connection at the end of standard input")
 	pflag.BoolVarP(&cfg.hex, "hex", "x", false, "hex dumping mode")
+	pflag.BoolVar(&cfg.httpProxyServer, "http-proxy-server", false, "serve as an HTTP CONNECT proxy in listen mode")
+	pflag.BoolVarP(&cfg.ipv4, "ipv4", "4", false, "use IPv4 addresses only")
+	pflag.BoolVarP(&cfg.ipv6, "ipv6", "6", false, "use IPv6 addresses only")
+	pflag.BoolVarP(&cfg.keepOpen, "keep-open", "k", false, "accept multiple connections in listen mode")
+	pflag.BoolVar(&cfg.lineMode, "line-mode", false, "send standard input line by line instead of as it arrives")
 	pflag.BoolVarP(&cfg.listen, "listenMode", "l", false, "listen mode for inbound connections")
+	pflag.BoolVar(&cfg.pty, "pty", false, "run the program of -e or -c in a pseudo-terminal (Linux only)")
+	pflag.BoolVar(&cfg.replyAll, "reply-all", false, "send standard input to every UDP peer in keep-open mode")
+	pflag.BoolVar(&cfg.socksServer, "socks-server", false, "serve as a SOCKS5 proxy in listen mode")
+	pflag.BoolVar(&cfg.ssl, "ssl", false, "connect or listen with TLS")
+	pflag.BoolVar(&cfg.sslVerify, "ssl-verify", false, "verify the server certificate")
 	pflag.BoolVarP(&cfg.udp, "udp", "u", false, "UDP mode")
+	pflag.BoolVarP(&cfg.unix, "unixsock", "U", false, "Unix domain socket mode")
 	pflag.BoolVarP(&cfg.verbose, "verbose", "v", false, "verbose mode")
-	pflag.IntVarP(&cfg.port, "port", "p", 0, "local port number")
+	pflag.DurationVar(&cfg.idleTimeout, "idle-timeout", 0, "close a connection after this long without data either way, 0 for never")
+	pflag.DurationVar(&cfg.peerTimeout, "peer-timeout", time.Minute, "idle time before a UDP peer expires in keep-open mode")
+	pflag.IntVarP(&cfg.port, "port", "p", 0, "local port number, the source port of outbound connections in client mode")
+	pflag.IntVarP(&cfg.wait, "wait", "w", 0, "seconds to wait for a connection to be made or accepted, 0 for no limit")
+	pflag.IntVarP(&cfg.quitDelay, "quit-after-eof", "q", -1, "seconds to wait after the end of standard input before quitting, negative to wait forever")
+	pflag.StringVar(&cfg.execStderr, "exec-stderr", "socket", "where the standard error of -e or -c goes: socket, console or a file path")
+	pflag.StringVar(&cfg.hexFile, "hex-file", "", "write hex dumps of the traffic both ways to this file")
+	pflag.StringVarP(&cfg.outFile, "output", "o", "", "write received data to this file")
+	pflag.StringVar(&cfg.proxy, "proxy", "", "connect through the proxy at host:port")
+	pflag.StringVar(&cfg.proxyAuth, "proxy-auth", "", "proxy credentials as user:password, required from clients of a proxy server")
+	pflag.StringVar(&cfg.proxyType, "proxy-type", "http", "proxy protocol: socks4, socks5 or http")
+	pflag.StringVar(&cfg.relay, "relay", "", "forward every connection to host:port in listen mode")
+	pflag.StringVarP(&cfg.source, "source", "s", "", "local address to make outbound connections and scan probes from")
+	pflag.StringVar(&cfg.sslALPN, "ssl-alpn", "", "comma separated list of ALPN protocols")
+	pflag.StringVar(&cfg.sslCert, "ssl-cert", "", "PEM certificate file for TLS, also presented as client certificate")
+	pflag.StringVar(&cfg.sslClientCA, "ssl-client-ca", "", "require client certificates signed by the CAs of this PEM file")
+	pflag.StringVar(&cfg.sslKey, "ssl-key", "", "PEM private key file for TLS")
+	pflag.StringVar(&cfg.sslServerName, "ssl-servername", "", "server name to request with SNI")
+	pflag.StringVar(&cfg.sslTrustFile, "ssl-trustfile", "", "PEM file of trusted CA certificates")
+	pflag.StringSliceVar(&cfg.sslAllow, "ssl-allow", nil, "comma separated client certificate names (CN or SAN) to allow")
+	pflag.StringSliceVar(&cfg.proxyAllow, "proxy-allow", nil, "comma separated targets a proxy server may connect to")
+	pflag.StringSliceVar(&cfg.proxyDeny, "proxy-deny", nil, "comma separated targets a proxy server refuses to connect to")
 	pflag.StringVarP(&cfg.zero, "zero", "z", "", "zero-I/O mode [used for scanning]")
-	pflag.StringVarP(&cfg.cmd, "exec", "e", "", "program to exec after connect")
+	pflag.StringVarP(&cfg.cmd, "exec", "e", "", "program to exec after connect, with its arguments")
+	pflag.StringVarP(&cfg.shExec, "sh-exec", "c", "", "command line to run with /bin/sh after connect")
 
 	pflag.Usage = func() {
 		var buf bytes.Buffer
@@ -44,6 +127,8 @@ func main() {
 		buf.WriteString("Usage:\n")
 		buf.WriteString("  gonc [-options] hostname port[s] [ports] ...\n")
 		buf.WriteString("  gonc -l -p port [-options] [hostname] [port]\n")
+		buf.WriteString("  gonc -U [-l] [-options] path\n")
+		buf.WriteString("  gonc [-options] address address\n")
 		buf.WriteString("Options:\n")
 
 		fmt.Fprintf(os.Stderr, buf.String())
@@ -52,48 +137,235 @@ func main() {
 
 	pflag.Parse()
 
-	if len(pflag.Args()) > 1 {
+	if len(pflag.Args()) > 2 || (cfg.ipv4 && cfg.ipv6) {
 		fmt.Printf("Incorrect argument format!\n")
 		pflag.Usage()
 		os.Exit(2)
 	}
 
+	if cfg.cmd != "" && cfg.shExec != "" {
+		fmt.Printf("Only one of -e and -c can be given!\n")
+		os.Exit(2)
+	}
+
+	if cfg.pty && !cfg.executes() {
+		fmt.Printf("--pty needs a program given with -e or -c!\n")
+		os.Exit(2)
+	}
+
+	if cfg.ssl && cfg.udp {
+		fmt.Printf("TLS is not supported in UDP mode!\n")
+		os.Exit(2)
+	}
+
+	if cfg.proxy != "" && (cfg.udp || cfg.unix) {
+		fmt.Printf("Proxies are only supported for TCP connections!\n")
+		os.Exit(2)
+	}
+
+	if cfg.relay != "" {
+		proto := "tcp"
+		if cfg.udp {
+			proto = "udp"
+		}
+		if _, err := cfg.relayEndpoint(proto); err != nil {
+			fmt.Printf("Invalid relay target: %v\n", err)
+			os.Exit(2)
+		}
+		if cfg.unix && cfg.udp {
+			fmt.Printf("Relaying is not supported for Unix datagram sockets!\n")
+			os.Exit(2)
+		}
+	}
+
+	// Proxy servers and relays forward the data of their clients instead of
+	// exchanging it with the standard input and output.
+	forwarding := cfg.socksServer || cfg.httpProxyServer || cfg.relay != ""
+	if cfg.broker || forwarding {
+		cfg.keepOpen = true
+	}
+	// Neither do the processes of -e and -c, which talk to the peer on their
+	// own.
+	readsInput := !forwarding && !cfg.executes()
+
 	logger := createLogger(cfg.debug)
 
+	capture, err := openCapture(cfg.outFile, cfg.hexFile)
+	if err != nil {
+		logger.Error("failed to create capture file", "error", err)
+		os.Exit(1)
+	}
+	cfg.capture = capture
+
 	app := &application{
 		config: cfg,
 		logger: logger,
 	}
 
+	if pflag.NArg() == 2 && isEndpointPair(pflag.Arg(0), pflag.Arg(1)) {
+		first, second, err := cfg.bridgeEndpoints(pflag.Arg(0), pflag.Arg(1))
+		if err != nil {
+			fmt.Printf("Invalid address: %v\n", err)
+			app.exit(2)
+		}
+
+		b := app.NewBridge(first, second)
+		if err := b.StartBridge(); err != nil {
+			logger.Error("failed to bridge endpoints", "first", first, "second", second, "error", err)
+			if cfg.verbose {
+				fmt.Printf("could not open %s\n", first)
+			}
+			app.exit(1)
+		}
+		app.exit(0)
+	}
+
 	if cfg.listen {
-		addr := fmt.Sprintf(":%d", cfg.port)
+		port := strconv.Itoa(cfg.port)
+		if cfg.port == 0 && pflag.NArg() == 2 {
+			port = pflag.Arg(1)
+		}
+		addr := net.JoinHostPort(pflag.Arg(0), port)
+		if cfg.unix {
+			addr = pflag.Arg(0)
+		}
 		if cfg.udp {
 			srv := app.NewUDPServer(addr)
-			go app.readInput(srv.quit, srv.sendch)
+			if readsInput {
+				go app.sendInput(os.Stdin, srv.quit, srv.sendch)
+			}
 			err := srv.StartUDP()
 			if err != nil {
 				logger.Error("failed to listen to UDP connections", "error", err)
-				os.Exit(1)
+				app.exit(1)
 			}
 		} else {
 			srv := app.NewTCPServer(addr)
-			go app.readInput(srv.quit, srv.sendch)
+			if readsInput {
+				go app.sendInput(os.Stdin, srv.quit, srv.sendch)
+			}
 			err := srv.StartTCP()
 			if err != nil {
 				logger.Error("failed to listen to TCP connections", "error", err)
-				os.Exit(1)
+				app.exit(1)
 			}
 		}
+		app.exit(0)
 	}
 
 	if cfg.zero != "" {
 		host := cfg.zero
 		portRange := pflag.Arg(0)
 		app.scanConnection(host, portRange)
-		os.Exit(0)
+		app.exit(0)
+	}
+
+	var addr string
+	switch {
+	case cfg.unix && pflag.NArg() == 1:
+		addr = pflag.Arg(0)
+	case !cfg.unix && pflag.NArg() == 2:
+		addr = net.JoinHostPort(pflag.Arg(0), pflag.Arg(1))
+	default:
+		fmt.Printf("Incorrect argument format!\n")
+		pflag.Usage()
+		app.exit(2)
+	}
+
+	if cfg.udp {
+		client := app.NewUDPClient(addr)
+		if readsInput {
+			go app.sendInput(os.Stdin, client.quit, client.sendch)
+		}
+		err := client.StartUDPClient()
+		if err != nil {
+			logger.Error("failed to connect to UDP server", "addr", addr, "error", err)
+			if cfg.verbose {
+				if isTimeout(err) {
+					fmt.Printf("connection to %s timed out\n", addr)
+				} else {
+					fmt.Printf("could not connect to %s\n", addr)
+				}
+			}
+			app.exit(1)
+		}
+	} else {
+		client := app.NewTCPClient(addr)
+		if readsInput {
+			go app.sendInput(os.Stdin, client.quit, client.sendch)
+		}
+		err := client.StartTCPClient()
+		if err != nil {
+			logger.Error("failed to connect to TCP server", "addr", addr, "error", err)
+			if cfg.verbose {
+				if isTimeout(err) {
+					fmt.Printf("connection to %s timed out\n", addr)
+				} else {
+					fmt.Printf("could not connect to %s\n", addr)
+				}
+			}
+			app.exit(1)
+		}
+	}
+
+	app.exit(0)
+}
+
+// isEndpointPair reports whether both arguments are socat-style address
+// specifications rather than a host and a port.
+func isEndpointPair(first, second string) bool {
+	_, _, ok1 := endpointKind(first)
+	_, _, ok2 := endpointKind(second)
+	return ok1 && ok2
+}
+
+// network returns the name of the given network ("tcp" or "udp") restricted
+// to IPv4 or IPv6 when one of them is forced, or its Unix domain socket
+// counterpart in Unix socket mode.
+func (cfg config) network(proto string) string {
+	switch {
+	case cfg.unix && proto == "tcp":
+		return "unix"
+	case cfg.unix && proto == "udp":
+		return "unixgram"
+	case cfg.ipv4:
+		return proto + "4"
+	case cfg.ipv6:
+		return proto + "6"
+	default:
+		return proto
 	}
 }
 
+// resolvePacketAddr resolves addr on a datagram network, either UDP or Unix
+// datagram sockets.
+func resolvePacketAddr(network, addr string) (net.Addr, error) {
+	if network == "unixgram" {
+		return net.ResolveUnixAddr(network, addr)
+	}
+	return net.ResolveUDPAddr(network, addr)
+}
+
+// removeSocketFile removes the file behind a Unix domain socket address.
+// Stream listeners remove it themselves on close, datagram sockets do not.
+// Abstract socket names starting with '@' have no file.
+func removeSocketFile(addr net.Addr) {
+	uAddr, ok := addr.(*net.UnixAddr)
+	if !ok || uAddr.Name == "" || strings.HasPrefix(uAddr.Name, "@") {
+		return
+	}
+	os.Remove(uAddr.Name)
+}
+
+// formatListenAddr formats a bound address for the verbose banners.
+func formatListenAddr(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return fmt.Sprintf("[%s]", addr)
+	}
+	return fmt.Sprintf("[%s] %s", host, port)
+}
+
 func createLogger(debug bool) *slog.Logger {
 	opts := slog.HandlerOptions{Level: slog.LevelError}
 
@@ -105,22 +377,75 @@ func createLogger(debug bool) *slog.Logger {
 	return slog.New(handler)
 }
 
-func (app *application) readInput(quit chan interface{}, sendch chan string) {
-	reader := bufio.NewReader(os.Stdin)
-	go func() {
+// sendInput sends the data read from r to sendch as it arrives, so binary
+// data and a last line without a newline go through unchanged. In line mode
+// every line is sent on its own instead. With -C line endings are sent as
+// CRLF. A nil message marks the end of the input. It gives up once quit is
+// closed, as nothing reads sendch anymore.
+func (app *application) sendInput(r io.Reader, quit chan interface{}, sendch chan []byte) {
+	send := func(msg []byte) bool {
 		select {
+		case sendch <- msg:
+			return true
 		case <-quit:
-			app.logger.Info("quit readInput")
-			os.Exit(0)
+			return false
 		}
-	}()
+	}
 
+	var cr bool
+	if app.config.lineMode {
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if app.config.crlf {
+					line = addCR(line, &cr)
+				}
+				if !send(line) {
+					return
+				}
+			}
+			if err != nil {
+				app.logger.Info("failed to read from standard input", "error", err)
+				send(nil)
+				return
+			}
+		}
+	}
+
+	buf := make([]byte, 32*1024)
 	for {
-		line, err := reader.ReadString('\n')
+		n, err := r.Read(buf)
+		if n > 0 {
+			var msg []byte
+			if app.config.crlf {
+				msg = addCR(buf[:n], &cr)
+			} else {
+				msg = bytes.Clone(buf[:n])
+			}
+			if !send(msg) {
+				return
+			}
+		}
 		if err != nil {
 			app.logger.Info("failed to read from standard input", "error", err)
+			send(nil)
 			return
 		}
-		sendch <- line
 	}
 }
+
+// quitAfterInput calls stop once the delay given with -q has passed after the
+// end of the standard input. A negative delay never stops.
+func (cfg config) quitAfterInput(stop func()) {
+	if cfg.quitDelay >= 0 {
+		time.AfterFunc(time.Duration(cfg.quitDelay)*time.Second, stop)
+	}
+}
+
+// exit closes the capture files of -o and --hex-file and ends the program
+// with the given status.
+func (app *application) exit(code int) {
+	app.config.capture.close()
+	os.Exit(code)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		crlf     bool
+		lineMode bool
+		input    string
+		expected []string
+	}{
+		{
+			name:     "Raw Chunks",
+			input:    "1st line\n2nd line\nno newline",
+			expected: []string{"1st line\n2nd line\nno newline"},
+		},
+		{
+			name:     "Binary Data",
+			input:    "\x00\xff\x1b\r\n\x00",
+			expected: []string{"\x00\xff\x1b\r\n\x00"},
+		},
+		{
+			name:     "CRLF",
+			crlf:     true,
+			input:    "EHLO example.com\r\nQUIT\n",
+			expected: []string{"EHLO example.com\r\nQUIT\r\n"},
+		},
+		{
+			name:     "Line Mode CRLF",
+			crlf:     true,
+			lineMode: true,
+			input:    "EHLO example.com\nQUIT",
+			expected: []string{"EHLO example.com\r\n", "QUIT"},
+		},
+		{
+			name:     "Line Mode",
+			lineMode: true,
+			input:    "1st line\n2nd line\nno newline",
+			expected: []string{"1st line\n", "2nd line\n", "no newline"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logBuf := createTestSlog()
+			app := &application{config: config{crlf: tt.crlf, lineMode: tt.lineMode}, logger: logger}
+
+			sendch := make(chan []byte)
+			go func() {
+				app.sendInput(strings.NewReader(tt.input), make(chan interface{}), sendch)
+				close(sendch)
+			}()
+
+			var actual []string
+			var ended bool
+			for data := range sendch {
+				if data == nil {
+					ended = true
+					continue
+				}
+				actual = append(actual, string(data))
+			}
+			assert.Equal(t, tt.expected, actual)
+			assert.True(t, ended)
+			assert.Equal(t, "msg=\"failed to read from standard input\" error=EOF\n", logBuf.String())
+		})
+	}
+}
+
+func TestSendInputQuit(t *testing.T) {
+	logger, _ := createTestSlog()
+	app := &application{config: config{}, logger: logger}
+
+	quit := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		// Nothing reads sendch, as in the -e and -c modes.
+		app.sendInput(strings.NewReader("unread"), quit, make(chan []byte))
+		close(done)
+	}()
+
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sendInput is still blocked after quit was closed")
+	}
+}
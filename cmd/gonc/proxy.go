@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var socks5Errors = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// dial opens an outbound connection to addr. TCP connections go through the
+// proxy given with --proxy when one is set.
+func (cfg config) dial(network, addr string) (net.Conn, error) {
+	d, err := cfg.dialer(network)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.proxy == "" || !strings.HasPrefix(network, "tcp") {
+		return d.Dial(network, addr)
+	}
+
+	conn, err := d.Dial(network, cfg.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Talking to the proxy is part of connecting, so -w covers it too.
+	if cfg.wait > 0 {
+		conn.SetDeadline(time.Now().Add(cfg.waitTimeout()))
+	}
+
+	user, pass, _ := strings.Cut(cfg.proxyAuth, ":")
+	switch cfg.proxyType {
+	case "socks4":
+		err = socks4Connect(conn, addr, user)
+	case "socks5":
+		err = socks5Connect(conn, addr, user, pass)
+	case "http":
+		conn, err = httpConnect(conn, addr, cfg.proxyAuth)
+	default:
+		err = fmt.Errorf("unknown proxy type %q", cfg.proxyType)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", cfg.proxy, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// dialer returns the dialer of outbound connections on network, bound to
+// the source address of -s and, in client mode, the source port of -p.
+func (cfg config) dialer(network string) (net.Dialer, error) {
+	d := net.Dialer{Timeout: cfg.waitTimeout()}
+	if cfg.source == "" && (cfg.listen || cfg.port == 0) {
+		return d, nil
+	}
+
+	port := 0
+	if !cfg.listen {
+		port = cfg.port
+	}
+	addr := net.JoinHostPort(cfg.source, strconv.Itoa(port))
+	var err error
+	switch {
+	case strings.HasPrefix(network, "tcp"):
+		d.LocalAddr, err = net.ResolveTCPAddr(network, addr)
+	case strings.HasPrefix(network, "udp"):
+		d.LocalAddr, err = net.ResolveUDPAddr(network, addr)
+	}
+	if err != nil {
+		return d, fmt.Errorf("source address: %w", err)
+	}
+	return d, nil
+}
+
+// socks4Connect asks a SOCKS4 proxy to connect to addr. Host names are
+// resolved by the proxy using the SOCKS4a extension.
+func socks4Connect(conn net.Conn, addr, user string) error {
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	req := []byte{0x04, 0x01}
+	req = binary.BigEndian.AppendUint16(req, port)
+
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		req = append(req, 0, 0, 0, 1)
+	} else {
+		req = append(req, ip...)
+	}
+	req = append(req, user...)
+	req = append(req, 0)
+	if ip == nil {
+		req = append(req, host...)
+		req = append(req, 0)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 8)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[1] != 0x5a {
+		return fmt.Errorf("SOCKS4 request rejected with code %d", resp[1])
+	}
+	return nil
+}
+
+// socks5Connect asks a SOCKS5 proxy to connect to addr, authenticating with
+// a username and password when one is given.
+func socks5Connect(conn net.Conn, addr, user, pass string) error {
+	methods := []byte{0x00}
+	if user != "" {
+		methods = []byte{0x00, 0x02}
+	}
+
+	greeting := append([]byte{0x05, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 0x05 {
+		return fmt.Errorf("unexpected SOCKS version %d", resp[0])
+	}
+
+	switch resp[1] {
+	case 0x00:
+	case 0x02:
+		if user == "" {
+			return errors.New("SOCKS5 proxy requires authentication")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(pass)))
+		auth = append(auth, pass...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		if resp[1] != 0x00 {
+			return errors.New("SOCKS5 authentication failed")
+		}
+	default:
+		return errors.New("no acceptable SOCKS5 authentication method")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	req, err := appendSocksAddr(req, addr)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0x00 {
+		msg, ok := socks5Errors[head[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown error %d", head[1])
+		}
+		return fmt.Errorf("SOCKS5 request failed: %s", msg)
+	}
+
+	_, err = readSocksAddr(conn)
+	return err
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel to addr with the CONNECT
+// method. The returned connection keeps any data read past the response.
+func httpConnect(conn net.Conn, addr, auth string) (net.Conn, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if auth != "" {
+		fmt.Fprintf(&b, "Proxy-Authorization: Basic %s\r\n", base64.StdEncoding.EncodeToString([]byte(auth)))
+	}
+	b.WriteString("\r\n")
+
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return conn, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("HTTP CONNECT failed: %s", resp.Status)
+	}
+
+	if r.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: r}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads first drain a bufio.Reader that
+// already consumed part of the stream.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite shuts down the write side of the underlying connection.
+func (c *bufferedConn) CloseWrite() error {
+	closeWrite(c.Conn)
+	return nil
+}
+
+// appendSocksAddr appends addr in the SOCKS5 address format: an address
+// type, the IPv4, IPv6 or domain name address and the port.
+func appendSocksAddr(b []byte, addr string) ([]byte, error) {
+	host, port, err := splitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, 0x01)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, 0x04)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name %q is too long", host)
+		}
+		b = append(b, 0x03, byte(len(host)))
+		b = append(b, host...)
+	}
+
+	return binary.BigEndian.AppendUint16(b, port), nil
+}
+
+// readSocksAddr reads an address in the SOCKS5 address format.
+func readSocksAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch atyp[0] {
+	case 0x01, 0x04:
+		ip := make(net.IP, 4)
+		if atyp[0] == 0x04 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(r, n); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", fmt.Errorf("unknown SOCKS address type %d", atyp[0])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func splitHostPort(addr string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q", portStr)
+	}
+	return host, uint16(port), nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyDial(t *testing.T) {
+	tests := []struct {
+		name        string
+		proxyPort   int
+		proxyType   string
+		proxyAuth   string
+		clientAuth  string
+		target      string
+		expectedErr bool
+	}{
+		{
+			name:      "SOCKS4 With IP Address",
+			proxyPort: 3030,
+			proxyType: "socks4",
+			target:    "127.0.0.1:3040",
+		},
+		{
+			name:      "SOCKS4a With Host Name",
+			proxyPort: 3031,
+			proxyType: "socks4",
+			target:    "localhost:3040",
+		},
+		{
+			name:      "SOCKS5 Without Authentication",
+			proxyPort: 3032,
+			proxyType: "socks5",
+			target:    "localhost:3040",
+		},
+		{
+			name:       "SOCKS5 With Authentication",
+			proxyPort:  3033,
+			proxyType:  "socks5",
+			proxyAuth:  "user:secret",
+			clientAuth: "user:secret",
+			target:     "localhost:3040",
+		},
+		{
+			name:        "SOCKS5 With Wrong Password",
+			proxyPort:   3034,
+			proxyType:   "socks5",
+			proxyAuth:   "user:secret",
+			clientAuth:  "user:wrong",
+			target:      "localhost:3040",
+			expectedErr: true,
+		},
+		{
+			name:      "HTTP CONNECT",
+			proxyPort: 3035,
+			proxyType: "http",
+			target:    "localhost:3040",
+		},
+		{
+			name:       "HTTP CONNECT With Authentication",
+			proxyPort:  3036,
+			proxyType:  "http",
+			proxyAuth:  "user:secret",
+			clientAuth: "user:secret",
+			target:     "localhost:3040",
+		},
+		{
+			name:        "HTTP CONNECT Without Credentials",
+			proxyPort:   3037,
+			proxyType:   "http",
+			proxyAuth:   "user:secret",
+			target:      "localhost:3040",
+			expectedErr: true,
+		},
+		{
+			name:        "SOCKS5 Target Refused",
+			proxyPort:   3038,
+			proxyType:   "socks5",
+			target:      "localhost:3041",
+			expectedErr: true,
+		},
+	}
+
+	target, err := net.Listen("tcp", "localhost:3040")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprintln(conn, "hello from the target")
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxyAddr := "localhost:" + strconv.Itoa(tt.proxyPort)
+			ln := startTestProxy(t, proxyAddr, tt.proxyType, tt.proxyAuth)
+			defer ln.Close()
+
+			cfg := config{proxy: proxyAddr, proxyType: tt.proxyType, proxyAuth: tt.clientAuth}
+			conn, err := cfg.dial("tcp", tt.target)
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			msg, err := bufio.NewReader(conn).ReadString('\n')
+			assert.NoError(t, err)
+			assert.Equal(t, "hello from the target\n", msg)
+		})
+	}
+}
+
+func TestTCPClientThroughProxy(t *testing.T) {
+	target, err := net.Listen("tcp", "localhost:3042")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	ln := startTestProxy(t, "localhost:3039", "socks5", "")
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{proxy: "localhost:3039", proxyType: "socks5"},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("localhost:3042")
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+	}()
+
+	conn, err := target.Accept()
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	client.sendch <- []byte("hello through the proxy\n")
+
+	msg, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "hello through the proxy\n", msg)
+
+	conn.Close()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="connected to TCP server"
+msg="message sent to server"
+msg="server disconnected"
+msg="stopping TCP client"
+msg="TCP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestScanThroughProxy(t *testing.T) {
+	target, err := net.Listen("tcp", "localhost:3043")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	ln := startTestProxy(t, "localhost:3044", "http", "")
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{proxy: "localhost:3044", proxyType: "http"},
+		logger: logger,
+	}
+
+	app.scanConnection("localhost", "3041-3043")
+	assert.Equal(t, "msg=\"Connection to localhost 127.0.0.1:3044 [tcp]\\n\"\n", logBuf.String())
+}
+
+// startTestProxy starts a stand-in proxy of the given type that handles
+// one request per connection and then splices it to the requested target.
+func startTestProxy(t *testing.T, addr, proxyType, auth string) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				var target string
+				var ok bool
+				switch proxyType {
+				case "socks4":
+					target, ok = readTestSocks4(r)
+				case "socks5":
+					target, ok = readTestSocks5(r, conn, auth)
+				case "http":
+					target, ok = readTestHTTPConnect(r, conn, auth)
+				}
+				if !ok {
+					return
+				}
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					if proxyType == "socks5" {
+						conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+					}
+					return
+				}
+				defer upstream.Close()
+
+				switch proxyType {
+				case "socks4":
+					conn.Write([]byte{0x00, 0x5a, 0, 0, 0, 0, 0, 0})
+				case "socks5":
+					conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				case "http":
+					io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				}
+
+				go io.Copy(upstream, r)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func readTestSocks4(r *bufio.Reader) (string, bool) {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return "", false
+	}
+	if _, err := r.ReadString(0); err != nil {
+		return "", false
+	}
+
+	host := net.IP(head[4:8]).String()
+	if head[4] == 0 && head[5] == 0 && head[6] == 0 {
+		name, err := r.ReadString(0)
+		if err != nil {
+			return "", false
+		}
+		host = name[:len(name)-1]
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(head[2:4])))), true
+}
+
+func readTestSocks5(r *bufio.Reader, w io.Writer, auth string) (string, bool) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return "", false
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return "", false
+	}
+
+	if auth == "" {
+		w.Write([]byte{0x05, 0x00})
+	} else {
+		w.Write([]byte{0x05, 0x02})
+		ver := make([]byte, 2)
+		if _, err := io.ReadFull(r, ver); err != nil {
+			return "", false
+		}
+		user := make([]byte, ver[1])
+		io.ReadFull(r, user)
+		n, _ := r.ReadByte()
+		pass := make([]byte, n)
+		io.ReadFull(r, pass)
+		if string(user)+":"+string(pass) != auth {
+			w.Write([]byte{0x01, 0x01})
+			return "", false
+		}
+		w.Write([]byte{0x01, 0x00})
+	}
+
+	req := make([]byte, 3)
+	if _, err := io.ReadFull(r, req); err != nil {
+		return "", false
+	}
+	target, err := readSocksAddr(r)
+	return target, err == nil
+}
+
+func readTestHTTPConnect(r *bufio.Reader, w io.Writer, auth string) (string, bool) {
+	req, err := http.ReadRequest(r)
+	if err != nil {
+		return "", false
+	}
+
+	if auth != "" {
+		expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
+		if req.Header.Get("Proxy-Authorization") != expected {
+			io.WriteString(w, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return "", false
+		}
+	}
+	return req.Host, true
+}
+
+func TestDialSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      config
+		network     string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "Source Address And Port",
+			config:   config{source: "127.0.0.1", port: 3086},
+			network:  "tcp",
+			expected: "127.0.0.1:3086",
+		},
+		{
+			name:     "Source Port Only",
+			config:   config{port: 3087},
+			network:  "tcp4",
+			expected: "127.0.0.1:3087",
+		},
+		{
+			name:     "Listen Port Is Not A Source Port",
+			config:   config{listen: true, port: 3085},
+			network:  "tcp",
+			expected: "",
+		},
+		{
+			name:        "Unknown Source",
+			config:      config{source: "no.such.host.invalid"},
+			network:     "tcp",
+			expectedErr: "source address",
+		},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:3085")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := tt.config.dial(tt.network, "127.0.0.1:3085")
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			peer, err := ln.Accept()
+			assert.NoError(t, err)
+			defer peer.Close()
+
+			if tt.expected == "" {
+				assert.NotEqual(t, "127.0.0.1:3085", peer.RemoteAddr().String())
+				return
+			}
+			assert.Equal(t, tt.expected, peer.RemoteAddr().String())
+		})
+	}
+}
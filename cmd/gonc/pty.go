@@ -0,0 +1,105 @@
+package main
+
+import "io"
+
+// Telnet commands understood by terminal sessions.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+	telnetNAWS = 31
+)
+
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSub
+	telnetSubIAC
+)
+
+// telnetReader strips telnet commands from the input of a terminal session.
+// The window sizes sent with NAWS subnegotiations (IAC SB NAWS width height
+// IAC SE) are reported to resize. An escaped IAC IAC is a literal 0xff byte.
+type telnetReader struct {
+	r      io.Reader
+	resize func(cols, rows uint16)
+	state  int
+	sub    []byte
+}
+
+func (t *telnetReader) Read(b []byte) (int, error) {
+	for {
+		n, err := t.r.Read(b)
+		n = t.filter(b[:n])
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// filter removes the telnet commands from p in place and returns the number
+// of data bytes left.
+func (t *telnetReader) filter(p []byte) int {
+	n := 0
+	for _, c := range p {
+		switch t.state {
+		case telnetData:
+			if c == telnetIAC {
+				t.state = telnetCommand
+				continue
+			}
+			p[n] = c
+			n++
+		case telnetCommand:
+			switch c {
+			case telnetIAC:
+				p[n] = c
+				n++
+				t.state = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				t.state = telnetOption
+			case telnetSB:
+				t.sub = t.sub[:0]
+				t.state = telnetSub
+			default:
+				t.state = telnetData
+			}
+		case telnetOption:
+			t.state = telnetData
+		case telnetSub:
+			if c == telnetIAC {
+				t.state = telnetSubIAC
+			} else if len(t.sub) < 16 {
+				t.sub = append(t.sub, c)
+			}
+		case telnetSubIAC:
+			switch c {
+			case telnetSE:
+				t.subnegotiation()
+				t.state = telnetData
+			case telnetIAC:
+				if len(t.sub) < 16 {
+					t.sub = append(t.sub, c)
+				}
+				t.state = telnetSub
+			default:
+				t.state = telnetData
+			}
+		}
+	}
+	return n
+}
+
+func (t *telnetReader) subnegotiation() {
+	if len(t.sub) != 5 || t.sub[0] != telnetNAWS || t.resize == nil {
+		return
+	}
+	cols := uint16(t.sub[1])<<8 | uint16(t.sub[2])
+	rows := uint16(t.sub[3])<<8 | uint16(t.sub[4])
+	t.resize(cols, rows)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// runPTY runs c in a new session with a pseudo-terminal as its controlling
+// terminal and connects the terminal to rw. Telnet window-size messages read
+// from rw resize the terminal. Standard error goes to stderr, or to the
+// terminal when stderr is nil.
+func runPTY(c *exec.Cmd, rw io.ReadWriter, stderr io.Writer) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+
+	c.Stdin = slave
+	c.Stdout = slave
+	c.Stderr = stderr
+	if stderr == nil {
+		c.Stderr = slave
+	}
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	setWindowSize(master, 80, 24)
+	err = c.Start()
+	slave.Close()
+	if err != nil {
+		return err
+	}
+
+	resize := func(cols, rows uint16) { setWindowSize(master, cols, rows) }
+	go io.Copy(master, &telnetReader{r: rw, resize: resize})
+
+	// The output ends once every process holding the terminal is gone.
+	output := make(chan struct{})
+	go func() {
+		io.Copy(rw, master)
+		close(output)
+	}()
+
+	err = c.Wait()
+	<-output
+	return err
+}
+
+// openPTY opens a new pseudo-terminal pair through /dev/ptmx.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("get pty number: %w", err)
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %w", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func setWindowSize(f *os.File, cols, rows uint16) error {
+	ws := struct{ rows, cols, x, y uint16 }{rows: rows, cols: cols}
+	return ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// ioctl calls ioctl without taking f out of non-blocking mode, so that
+// closing f still interrupts pending reads.
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteTCPCmdPTY(t *testing.T) {
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{pty: true, shExec: `test -t 0 && echo tty; stty size; read line; stty size`},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3078")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:3078")
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	r := bufio.NewReader(conn)
+	var lines []string
+	readLine := func() {
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	readLine()
+	readLine()
+
+	// Resize the terminal to 100x40, then let the shell carry on.
+	conn.Write([]byte{255, 250, 31, 0, 100, 0, 40, 255, 240})
+	time.Sleep(50 * time.Millisecond)
+	conn.Write([]byte("go\n"))
+	readLine()
+	readLine()
+
+	assert.Equal(t, []string{"tty", "24 80", "go", "40 100"}, lines)
+
+	// The session ends with the shell.
+	_, err = r.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+func runPTY(c *exec.Cmd, rw io.ReadWriter, stderr io.Writer) error {
+	return errors.New("pseudo-terminals are only supported on Linux")
+}
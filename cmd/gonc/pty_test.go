@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelnetReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   [][]byte
+		expected string
+		sizes    [][2]uint16
+	}{
+		{
+			name:     "Plain Data",
+			chunks:   [][]byte{[]byte("ls -l\n")},
+			expected: "ls -l\n",
+		},
+		{
+			name:     "Window Size",
+			chunks:   [][]byte{{'a', 255, 250, 31, 0, 120, 0, 40, 255, 240, 'b'}},
+			expected: "ab",
+			sizes:    [][2]uint16{{120, 40}},
+		},
+		{
+			name:     "Window Size Split Across Reads",
+			chunks:   [][]byte{{255, 250, 31, 1}, {44, 0}, {50, 255}, {240, 'x'}},
+			expected: "x",
+			sizes:    [][2]uint16{{300, 50}},
+		},
+		{
+			name:     "Escaped Size Byte",
+			chunks:   [][]byte{{255, 250, 31, 0, 255, 255, 0, 24, 255, 240}},
+			expected: "",
+			sizes:    [][2]uint16{{255, 24}},
+		},
+		{
+			name:     "Negotiation",
+			chunks:   [][]byte{{255, 251, 31, 'o', 'k', 255, 241}},
+			expected: "ok",
+		},
+		{
+			name:     "Escaped IAC",
+			chunks:   [][]byte{{'a', 255, 255, 'b'}},
+			expected: "a\xffb",
+		},
+		{
+			name:     "Other Subnegotiation",
+			chunks:   [][]byte{{255, 250, 24, 0, 'x', 't', 255, 240, 'z'}},
+			expected: "z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var readers []io.Reader
+			for _, c := range tt.chunks {
+				readers = append(readers, bytes.NewReader(c))
+			}
+
+			var sizes [][2]uint16
+			r := &telnetReader{
+				r:      io.MultiReader(readers...),
+				resize: func(cols, rows uint16) { sizes = append(sizes, [2]uint16{cols, rows}) },
+			}
+
+			actual, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(actual))
+			assert.Equal(t, tt.sizes, sizes)
+		})
+	}
+}
@@ -33,7 +33,7 @@ func (app *application) scanConnection(host, portRange string) {
 
 	for _, port := range ports {
 		addr := net.JoinHostPort(host, port)
-		conn, err := net.Dial("tcp", addr)
+		conn, err := app.config.dial(app.config.network("tcp"), addr)
 		if err == nil {
 			msg := fmt.Sprintf("Connection to %s %s [%s]\n", host, conn.RemoteAddr(), conn.RemoteAddr().Network())
 			app.logger.Info(msg)
@@ -43,6 +43,12 @@ func (app *application) scanConnection(host, portRange string) {
 			conn.Close()
 			return
 		}
+		if isTimeout(err) {
+			app.logger.Info("connection timed out", "addr", addr)
+			if app.config.verbose {
+				fmt.Printf("Connection to %s timed out\n", addr)
+			}
+		}
 	}
 	msg := fmt.Sprintf("Could not connect to %s:%s\n", host, portRange)
 	app.logger.Info(msg)
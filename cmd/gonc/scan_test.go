@@ -71,3 +71,28 @@ func TestScanConnection(t *testing.T) {
 		})
 	}
 }
+
+func TestScanSourcePort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:8001")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	rAddr := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		rAddr <- conn.RemoteAddr().String()
+		conn.Close()
+	}()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{source: "127.0.0.1", port: 3088, zero: "127.0.0.1"},
+		logger: logger,
+	}
+	app.scanConnection(app.config.zero, "8001")
+
+	assert.Equal(t, "127.0.0.1:3088", <-rAddr)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+const (
+	socksCmdConnect      = 0x01
+	socksCmdUDPAssociate = 0x03
+
+	socksMethodNone     = 0x00
+	socksMethodPassword = 0x02
+	socksMethodRejected = 0xff
+
+	socksReplySucceeded          = 0x00
+	socksReplyGeneralFailure     = 0x01
+	socksReplyNotAllowed         = 0x02
+	socksReplyHostUnreachable    = 0x04
+	socksReplyConnectionRefused  = 0x05
+	socksReplyCommandUnsupported = 0x07
+)
+
+// serveSOCKS runs the SOCKS5 protocol on a client session: it negotiates the
+// authentication method, then either connects to the requested target and
+// splices both connections or relays UDP datagrams for the client.
+func (srv *TCPServer) serveSOCKS(s *tcpSession) {
+	conn := s.conn
+
+	cmd, target, err := srv.socksHandshake(conn)
+	if err != nil {
+		srv.logger.Error("SOCKS5 handshake failed", "remoteAddr", conn.RemoteAddr(), "error", err)
+		srv.closeSession(s)
+		return
+	}
+
+	switch cmd {
+	case socksCmdConnect:
+		srv.logger.Info("SOCKS5 connect", "remoteAddr", conn.RemoteAddr(), "target", target)
+		addrs, err := srv.checkTarget(target)
+		if errors.Is(err, errTargetDenied) {
+			srv.logger.Error("proxy target not allowed", "remoteAddr", conn.RemoteAddr(), "target", target)
+			writeSocksReply(conn, socksReplyNotAllowed, nil)
+			srv.closeSession(s)
+			return
+		}
+		if err != nil {
+			srv.logger.Error("failed to resolve SOCKS5 target", "target", target, "error", err)
+			writeSocksReply(conn, socksReplyHostUnreachable, nil)
+			srv.closeSession(s)
+			return
+		}
+
+		if srv.config.verbose {
+			fmt.Printf("SOCKS5 CONNECT to [%s] from [%s]\n", target, conn.RemoteAddr())
+		}
+
+		upstream, err := srv.dialTarget(addrs)
+		if err != nil {
+			srv.logger.Error("failed to connect to SOCKS5 target", "target", target, "error", err)
+			writeSocksReply(conn, socksErrorReply(err), nil)
+			srv.closeSession(s)
+			return
+		}
+
+		if err := writeSocksReply(conn, socksReplySucceeded, upstream.LocalAddr()); err != nil {
+			upstream.Close()
+			srv.closeSession(s)
+			return
+		}
+		srv.splice(s, upstream, target)
+	case socksCmdUDPAssociate:
+		srv.socksUDPAssociate(s)
+	default:
+		srv.logger.Error("unsupported SOCKS5 command", "remoteAddr", conn.RemoteAddr(), "cmd", cmd)
+		writeSocksReply(conn, socksReplyCommandUnsupported, nil)
+		srv.closeSession(s)
+	}
+}
+
+// dialTarget connects to the first of the addresses of a proxy target that
+// answers, like any outbound connection, so that -4/-6, the source address
+// of -s and the connect timeout of -w apply.
+func (srv *TCPServer) dialTarget(addrs []string) (net.Conn, error) {
+	network := "tcp"
+	if !srv.config.unix {
+		network = srv.config.network("tcp")
+	}
+	d, err := srv.config.dialer(network)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, addr := range addrs {
+		conn, err = d.Dial(network, addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// socksHandshake reads the method selection and the request of a SOCKS5
+// client and returns the requested command and target address.
+func (srv *TCPServer) socksHandshake(conn net.Conn) (byte, string, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return 0, "", err
+	}
+	if head[0] != 0x05 {
+		return 0, "", fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return 0, "", err
+	}
+
+	method := byte(socksMethodNone)
+	if srv.config.proxyAuth != "" {
+		method = socksMethodPassword
+	}
+	if !bytes.Contains(methods, []byte{method}) {
+		conn.Write([]byte{0x05, socksMethodRejected})
+		return 0, "", errors.New("no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{0x05, method}); err != nil {
+		return 0, "", err
+	}
+
+	if method == socksMethodPassword {
+		if err := srv.socksAuthenticate(conn); err != nil {
+			return 0, "", err
+		}
+	}
+
+	req := make([]byte, 3)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return 0, "", err
+	}
+	target, err := readSocksAddr(conn)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return req[1], target, nil
+}
+
+// socksAuthenticate checks the username and password of a client against
+// the credentials given with --proxy-auth.
+func (srv *TCPServer) socksAuthenticate(conn net.Conn) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	user := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, user); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, head[:1]); err != nil {
+		return err
+	}
+	pass := make([]byte, head[0])
+	if _, err := io.ReadFull(conn, pass); err != nil {
+		return err
+	}
+
+	if string(user)+":"+string(pass) != srv.config.proxyAuth {
+		conn.Write([]byte{0x01, 0x01})
+		return fmt.Errorf("authentication failed for user %q", user)
+	}
+	_, err := conn.Write([]byte{0x01, 0x00})
+	return err
+}
+
+// socksUDPAssociate relays datagrams between the client and any target for
+// as long as the client keeps its TCP connection open.
+func (srv *TCPServer) socksUDPAssociate(s *tcpSession) {
+	conn := s.conn
+	lHost, _, _ := net.SplitHostPort(conn.LocalAddr().String())
+	relay, err := net.ListenPacket("udp", net.JoinHostPort(lHost, "0"))
+	if err != nil {
+		srv.logger.Error("failed to open SOCKS5 UDP relay", "error", err)
+		writeSocksReply(conn, socksReplyGeneralFailure, nil)
+		srv.closeSession(s)
+		return
+	}
+	defer relay.Close()
+
+	if err := writeSocksReply(conn, socksReplySucceeded, relay.LocalAddr()); err != nil {
+		srv.closeSession(s)
+		return
+	}
+
+	srv.logger.Info("SOCKS5 UDP associate", "remoteAddr", conn.RemoteAddr(), "relay", relay.LocalAddr())
+	if srv.config.verbose {
+		fmt.Printf("SOCKS5 UDP ASSOCIATE on [%s] from [%s]\n", relay.LocalAddr(), conn.RemoteAddr())
+	}
+
+	go srv.relaySOCKSDatagrams(s, relay)
+
+	// The association lasts until the client closes its TCP connection.
+	io.Copy(io.Discard, conn)
+	srv.logger.Info("client disconnected", "remoteAddr", conn.RemoteAddr())
+	srv.closeSession(s)
+}
+
+// relaySOCKSDatagrams forwards the encapsulated datagrams of a client to
+// their targets, and datagrams of the targets back to the client.
+func (srv *TCPServer) relaySOCKSDatagrams(s *tcpSession, relay net.PacketConn) {
+	clientHost, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	var clientAddr net.Addr
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, addr, err := relay.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		host, _, _ := net.SplitHostPort(addr.String())
+		if host == clientHost && (clientAddr == nil || clientAddr.String() == addr.String()) {
+			clientAddr = addr
+
+			// RSV(2) FRAG(1) ATYP DST.ADDR DST.PORT DATA
+			if n < 4 || buf[2] != 0 {
+				continue
+			}
+			r := bytes.NewReader(buf[3:n])
+			target, err := readSocksAddr(r)
+			if err != nil {
+				continue
+			}
+			addrs, err := srv.checkTarget(target)
+			if errors.Is(err, errTargetDenied) {
+				continue
+			}
+			var tAddr *net.UDPAddr
+			if err == nil {
+				tAddr, err = net.ResolveUDPAddr("udp", addrs[0])
+			}
+			if err != nil {
+				srv.logger.Error("failed to resolve SOCKS5 UDP target", "target", target, "error", err)
+				continue
+			}
+			data := buf[n-r.Len() : n]
+			if _, err := relay.WriteTo(data, tAddr); err == nil {
+				s.bytesRcvd += len(data)
+			}
+			continue
+		}
+
+		if clientAddr == nil {
+			continue
+		}
+		packet, err := appendSocksAddr([]byte{0, 0, 0}, addr.String())
+		if err != nil {
+			continue
+		}
+		packet = append(packet, buf[:n]...)
+		if _, err := relay.WriteTo(packet, clientAddr); err == nil {
+			s.bytesSent += n
+		}
+	}
+}
+
+// writeSocksReply sends a SOCKS5 reply with the given bound address, or an
+// unspecified IPv4 address when addr is nil.
+func writeSocksReply(conn net.Conn, rep byte, addr net.Addr) error {
+	reply := []byte{0x05, rep, 0x00}
+	bound := "0.0.0.0:0"
+	if addr != nil {
+		bound = addr.String()
+	}
+
+	reply, err := appendSocksAddr(reply, bound)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(reply)
+	return err
+}
+
+// socksErrorReply maps a dial error to a SOCKS5 reply code.
+func socksErrorReply(err error) byte {
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socksReplyConnectionRefused
+	case errors.As(err, &dnsErr):
+		return socksReplyHostUnreachable
+	default:
+		return socksReplyGeneralFailure
+	}
+}
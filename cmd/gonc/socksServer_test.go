@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSOCKSServerConnect(t *testing.T) {
+	tests := []struct {
+		name        string
+		port        string
+		serverAuth  string
+		clientAuth  string
+		target      string
+		expectedErr bool
+		expected    string
+	}{
+		{
+			name:   "Connect Without Authentication",
+			port:   "3050",
+			target: "localhost:3059",
+			expected: `msg="starting TCP server"
+msg="connected to"
+msg="SOCKS5 connect"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`,
+		},
+		{
+			name:       "Connect With Authentication",
+			port:       "3051",
+			serverAuth: "user:secret",
+			clientAuth: "user:secret",
+			target:     "127.0.0.1:3059",
+			expected: `msg="starting TCP server"
+msg="connected to"
+msg="SOCKS5 connect"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`,
+		},
+		{
+			name:        "Wrong Password",
+			port:        "3052",
+			serverAuth:  "user:secret",
+			clientAuth:  "user:wrong",
+			target:      "localhost:3059",
+			expectedErr: true,
+			expected: `msg="starting TCP server"
+msg="connected to"
+msg="SOCKS5 handshake failed" error="authentication failed for user \"user\""
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`,
+		},
+		{
+			name:        "Target Refused",
+			port:        "3053",
+			target:      "127.0.0.1:3058",
+			expectedErr: true,
+			expected: `msg="starting TCP server"
+msg="connected to"
+msg="SOCKS5 connect"
+msg="failed to connect to SOCKS5 target" error="dial tcp 127.0.0.1:3058: connect: connection refused"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`,
+		},
+	}
+
+	target, err := net.Listen("tcp", "localhost:3059")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logBuf := createTestSlog()
+
+			app := &application{
+				config: config{socksServer: true, keepOpen: true, proxyAuth: tt.serverAuth},
+				logger: logger,
+			}
+
+			srv := app.NewTCPServer("localhost:" + tt.port)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			cfg := config{proxy: "localhost:" + tt.port, proxyType: "socks5", proxyAuth: tt.clientAuth}
+			conn, err := cfg.dial("tcp", tt.target)
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+
+				fmt.Fprintln(conn, "hello through the proxy")
+				msg, err := bufio.NewReader(conn).ReadString('\n')
+				assert.NoError(t, err)
+				assert.Equal(t, "hello through the proxy\n", msg)
+				conn.Close()
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			srv.stopTCP()
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, tt.expected, logBuf.String())
+		})
+	}
+}
+
+func TestSOCKSServerSourceAddress(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:3093")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	from := make(chan string, 1)
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		from <- host
+	}()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{socksServer: true, keepOpen: true, source: "127.0.0.2"},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3094")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	defer srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	cfg := config{proxy: "127.0.0.1:3094", proxyType: "socks5"}
+	conn, err := cfg.dial("tcp", "127.0.0.1:3093")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// The proxy connects to the target from the address given with -s.
+	assert.Equal(t, "127.0.0.2", <-from)
+}
+
+func TestSOCKSServerUDPAssociate(t *testing.T) {
+	var wg sync.WaitGroup
+
+	echo, err := net.ListenPacket("udp", "127.0.0.1:3057")
+	assert.NoError(t, err)
+	defer echo.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{socksServer: true, keepOpen: true},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3054")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+
+	var actual []byte
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		ctrl, err := net.Dial("tcp", "127.0.0.1:3054")
+		assert.NoError(t, err)
+		defer ctrl.Close()
+
+		ctrl.Write([]byte{0x05, 0x01, 0x00})
+		resp := make([]byte, 2)
+		_, err = io.ReadFull(ctrl, resp)
+		assert.NoError(t, err)
+
+		req, _ := appendSocksAddr([]byte{0x05, 0x03, 0x00}, "0.0.0.0:0")
+		ctrl.Write(req)
+		head := make([]byte, 3)
+		_, err = io.ReadFull(ctrl, head)
+		assert.NoError(t, err)
+		assert.Equal(t, byte(0x00), head[1])
+		relayAddr, err := readSocksAddr(ctrl)
+		assert.NoError(t, err)
+
+		client, err := net.Dial("udp", relayAddr)
+		assert.NoError(t, err)
+		defer client.Close()
+
+		packet, _ := appendSocksAddr([]byte{0, 0, 0}, "127.0.0.1:3057")
+		client.Write(append(packet, "hello over udp"...))
+
+		buf := make([]byte, 1024)
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := client.Read(buf)
+		assert.NoError(t, err)
+
+		r := bytes.NewReader(buf[3:n])
+		from, err := readSocksAddr(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:3057", from)
+		actual = buf[n-r.Len() : n]
+	}()
+
+	wg.Wait()
+	time.Sleep(50 * time.Millisecond)
+	srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="SOCKS5 UDP associate"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, "hello over udp", string(actual))
+}
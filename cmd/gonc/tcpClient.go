@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+type TCPClient struct {
+	bytesRcvd int
+	bytesSent int
+	config    config
+	conn      net.Conn
+	rAddrStr  string
+	logger    *slog.Logger
+	mu        sync.Mutex
+	quit      chan interface{}
+	sendch    chan []byte
+}
+
+func (app *application) NewTCPClient(addr string) *TCPClient {
+	return &TCPClient{
+		config:   app.config,
+		rAddrStr: addr,
+		logger:   app.logger,
+		quit:     make(chan interface{}),
+		sendch:   make(chan []byte),
+	}
+}
+
+func (c *TCPClient) StartTCPClient() error {
+	conn, err := c.config.dial(c.config.network("tcp"), c.rAddrStr)
+	if err != nil {
+		return err
+	}
+	conn = c.config.idle(conn)
+
+	c.logger.Info("connected to TCP server", "remoteAddr", conn.RemoteAddr())
+	if c.config.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.RemoteAddr(), conn.LocalAddr(), conn.RemoteAddr().Network())
+	}
+
+	if c.config.ssl {
+		host, _, _ := net.SplitHostPort(c.rAddrStr)
+		tlsConfig, err := c.config.clientTLSConfig(host)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+
+		state := tlsConn.ConnectionState()
+		c.logger.Info("TLS handshake complete", "version", tls.VersionName(state.Version), "cipher", tls.CipherSuiteName(state.CipherSuite))
+		if c.config.verbose {
+			printTLSState(state)
+		}
+	}
+	c.conn = conn
+
+	go func() {
+		sigch := make(chan os.Signal, 1)
+		signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case s := <-sigch:
+			c.logger.Info("received operating system signal", "sig", s)
+			c.stopTCPClient()
+		case <-c.quit:
+			signal.Stop(sigch)
+		}
+	}()
+
+	if c.config.executes() {
+		go c.executeTCPCmd(conn)
+	} else {
+		go c.readTCP(conn)
+		go c.writeTCP(conn)
+	}
+
+	<-c.quit
+	c.logger.Info("TCP client shutdown successfully")
+	return nil
+}
+
+func (c *TCPClient) stopTCPClient() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.quit:
+		return
+	default:
+	}
+
+	if c.config.verbose && !c.config.executes() {
+		fmt.Printf("sent %d, rcvd %d\n", c.bytesSent, c.bytesRcvd)
+	}
+	c.logger.Info("stopping TCP client")
+	close(c.quit)
+	c.conn.Close()
+}
+
+func (c *TCPClient) readTCP(conn net.Conn) {
+	buf := make([]byte, 2048)
+	var dataRead []byte
+	var pending bool
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+				c.logger.Info("server disconnected", "remoteAddr", conn.RemoteAddr())
+				c.stopTCPClient()
+				return
+			}
+			if isTimeout(err) {
+				c.logger.Info("connection timed out", "remoteAddr", conn.RemoteAddr(), "error", err)
+				if c.config.verbose {
+					fmt.Printf("Connection to [%s] timed out\n", conn.RemoteAddr())
+				}
+				c.stopTCPClient()
+				return
+			}
+
+			select {
+			case <-c.quit:
+				return
+			default:
+				c.logger.Error("failed to read from tcp connection", "error", err)
+				c.stopTCPClient()
+				return
+			}
+		}
+		c.bytesRcvd += n
+		dataRead = buf[:n]
+		c.logger.Info("received data", "remoteAddr", conn.RemoteAddr(), "bytes", n)
+		text := c.config.received(dataRead, &pending)
+		fmt.Print(string(text))
+		c.config.capture.output(text)
+		c.config.capture.dumpRecv(conn.RemoteAddr(), dataRead)
+
+		if c.config.hex {
+			fmt.Printf("Received %d bytes from the socket\n", n)
+			fmt.Printf("%s", hex.Dump(dataRead))
+		}
+	}
+}
+
+func (c *TCPClient) writeTCP(conn net.Conn) {
+	for {
+		var msg []byte
+		select {
+		case msg = <-c.sendch:
+		case <-c.quit:
+			return
+		}
+		if msg == nil {
+			if c.config.halfClose {
+				closeWrite(conn)
+			}
+			c.config.quitAfterInput(c.stopTCPClient)
+			continue
+		}
+
+		n, err := conn.Write(msg)
+		if err != nil {
+			c.logger.Error("failed to write to tcp connection", "error", err)
+			return
+		}
+		c.bytesSent += n
+		c.logger.Info("message sent to server", "remoteAddr", conn.RemoteAddr())
+		c.config.capture.dumpSent(conn.RemoteAddr(), msg)
+
+		if c.config.hex {
+			fmt.Printf("Sent %d bytes to the socket\n", n)
+			fmt.Printf("%s", hex.Dump(msg))
+		}
+	}
+}
+
+func (c *TCPClient) executeTCPCmd(conn net.Conn) {
+	e, err := c.config.command()
+	if err == nil {
+		e.Env = commandEnv(conn.LocalAddr(), conn.RemoteAddr())
+		err = c.config.runCommand(e, conn)
+	}
+	c.config.reportExit(c.logger, e, err)
+	c.stopTCPClient()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPClientMessaging(t *testing.T) {
+	var wg sync.WaitGroup
+
+	ln, err := net.Listen("tcp", ":3100")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{verbose: true, hex: true},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("localhost:3100")
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+	}()
+
+	var actualMsg string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		conn, err := ln.Accept()
+		assert.NoError(t, err)
+
+		_, err = conn.Write([]byte("hello from the server\n"))
+		assert.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+		client.sendch <- []byte("hello from the client\n")
+
+		actualMsg, err = bufio.NewReader(conn).ReadString('\n')
+		assert.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+		conn.Close()
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="connected to TCP server"
+msg="received data"
+msg="message sent to server"
+msg="server disconnected"
+msg="stopping TCP client"
+msg="TCP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, "hello from the client\n", actualMsg)
+}
+
+func TestTCPClientConnectionRefused(t *testing.T) {
+	logger, _ := createTestSlog()
+
+	app := &application{
+		config: config{verbose: true},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("localhost:3101")
+	err := client.StartTCPClient()
+	assert.Error(t, err)
+}
+
+func TestTCPClientConcurrentStop(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:3098")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+	app := &application{config: config{}, logger: logger}
+
+	client := app.NewTCPClient("127.0.0.1:3098")
+	done := make(chan struct{})
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// The reader, the signal handler and the -q timer may all stop the
+	// client at once.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.stopTCPClient()
+		}()
+	}
+	wg.Wait()
+	<-done
+
+	expected := `msg="connected to TCP server"
+msg="stopping TCP client"
+msg="TCP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestTCPClientExecuteCmd(t *testing.T) {
+	ln, err := net.Listen("tcp", ":3102")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, _ := createTestSlog()
+
+	app := &application{
+		config: config{cmd: "/bin/bash"},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("localhost:3102")
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+	}()
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("echo Hello\n"))
+	assert.NoError(t, err)
+
+	actual, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello\n", actual)
+}
+
+func TestTCPClientHalfClose(t *testing.T) {
+	ln, err := net.Listen("tcp", ":3081")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{halfClose: true, quitDelay: -1},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("localhost:3081")
+	done := make(chan struct{})
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client.sendch <- []byte("request")
+	client.sendch <- nil
+
+	// The request is complete once the client shuts down its write side.
+	request, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "request", string(request))
+
+	_, err = conn.Write([]byte("response\n"))
+	assert.NoError(t, err)
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("client did not quit after the response")
+	}
+
+	expected := `msg="connected to TCP server"
+msg="message sent to server"
+msg="received data"
+msg="server disconnected"
+msg="stopping TCP client"
+msg="TCP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestTCPClientCapture(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:3091")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	dir := t.TempDir()
+	capture, err := openCapture(filepath.Join(dir, "session.out"), filepath.Join(dir, "session.hex"))
+	assert.NoError(t, err)
+	defer capture.close()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{capture: capture, crlfRecv: true, quitDelay: -1},
+		logger: logger,
+	}
+
+	client := app.NewTCPClient("127.0.0.1:3091")
+	done := make(chan struct{})
+	go func() {
+		err := client.StartTCPClient()
+		assert.NoError(t, err)
+		close(done)
+	}()
+
+	conn, err := ln.Accept()
+	assert.NoError(t, err)
+
+	client.sendch <- []byte("PING\n")
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "PING\n", string(buf[:n]))
+
+	_, err = conn.Write([]byte("PONG\r\n"))
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	<-done
+
+	// The output file gets the data as printed, the dumps what was on the wire.
+	data, err := os.ReadFile(filepath.Join(dir, "session.out"))
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "session.hex"))
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\S+ > 127\.0\.0\.1:3091 5 bytes\n00000000  50 49 4e 47 0a .*\n\S+ < 127\.0\.0\.1:3091 6 bytes\n00000000  50 4f 4e 47 0d 0a .*\n$`, string(data))
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -8,21 +10,39 @@ import (
 	"log/slog"
 	"net"
 	"os"
-	"os/exec"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type TCPServer struct {
-	bytesRcvd int
-	bytesSent int
+	acceptErr error
 	config    config
-	conn      net.Conn
 	lAddrStr  string
 	ln        net.Listener
 	logger    *slog.Logger
+	mu        sync.Mutex
 	quit      chan interface{}
-	sendch    chan string
+	sendch    chan []byte
+	sessions  map[*tcpSession]struct{}
+	startSend sync.Once
+}
+
+// A client session may fall sendQueueLen messages behind. When its queue
+// stays full for sendQueueTimeout the broker disconnects it.
+const (
+	sendQueueLen     = 64
+	sendQueueTimeout = time.Second
+)
+
+type tcpSession struct {
+	bytesRcvd int
+	bytesSent int
+	closed    chan struct{}
+	conn      net.Conn
+	inputDone chan struct{}
+	sendq     chan []byte
 }
 
 func (app *application) NewTCPServer(addr string) *TCPServer {
@@ -31,20 +51,30 @@ func (app *application) NewTCPServer(addr string) *TCPServer {
 		lAddrStr: addr,
 		logger:   app.logger,
 		quit:     make(chan interface{}),
-		sendch:   make(chan string),
+		sendch:   make(chan []byte),
+		sessions: make(map[*tcpSession]struct{}),
 	}
 }
 
 func (srv *TCPServer) StartTCP() error {
-	ln, err := net.Listen("tcp", srv.lAddrStr)
+	ln, err := net.Listen(srv.config.network("tcp"), srv.lAddrStr)
 	if err != nil {
 		return err
 	}
+	ln = srv.config.timeoutListener(ln)
+	if srv.config.ssl {
+		tlsConfig, err := srv.config.serverTLSConfig()
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
 	srv.ln = ln
 
 	srv.logger.Info("starting TCP server", "addr", srv.lAddrStr)
 	if srv.config.verbose {
-		fmt.Printf("Listening on [any] %d...\n", srv.config.port)
+		fmt.Printf("Listening on %s...\n", formatListenAddr(ln.Addr()))
 	}
 
 	go srv.acceptTCP()
@@ -59,57 +89,241 @@ func (srv *TCPServer) StartTCP() error {
 
 	<-srv.quit
 	srv.logger.Info("TCP server shutdown successfully")
-	return nil
+	return srv.acceptErr
 }
 
 func (srv *TCPServer) stopTCP() {
-	if srv.config.verbose && srv.config.cmd == "" {
-		fmt.Printf("sent %d, rcvd %d\n", srv.bytesSent, srv.bytesRcvd)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	select {
+	case <-srv.quit:
+		return
+	default:
+	}
+
+	if srv.config.verbose && !srv.config.executes() && !srv.config.keepOpen {
+		var sent, rcvd int
+		for s := range srv.sessions {
+			sent += s.bytesSent
+			rcvd += s.bytesRcvd
+		}
+		fmt.Printf("sent %d, rcvd %d\n", sent, rcvd)
 	}
 	srv.logger.Info("stopping TCP connection")
-	close(srv.sendch)
 	close(srv.quit)
-	if srv.conn != nil {
-		srv.conn.Close()
+	srv.ln.Close()
+	for s := range srv.sessions {
+		s.conn.Close()
 	}
 }
 
 func (srv *TCPServer) acceptTCP() {
-	conn, err := srv.ln.Accept()
-	if err != nil {
-		select {
-		case <-srv.quit:
+	for {
+		conn, err := srv.ln.Accept()
+		if err != nil {
+			if isTimeout(err) {
+				srv.logger.Error("timed out waiting for a connection", "error", err)
+				if srv.config.verbose {
+					fmt.Printf("No connection within %s\n", srv.config.waitTimeout())
+				}
+				srv.acceptErr = err
+				srv.stopTCP()
+				return
+			}
+
+			select {
+			case <-srv.quit:
+			default:
+				srv.logger.Error("failed to accept listener", "error", err)
+			}
+			return
+		}
+
+		if !srv.config.keepOpen {
+			srv.ln.Close()
+		}
+
+		srv.logger.Info("connected to", "remoteAddr", conn.RemoteAddr())
+
+		if srv.config.verbose {
+			fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.LocalAddr(), conn.RemoteAddr(), conn.RemoteAddr().Network())
+		}
+
+		s := &tcpSession{
+			closed:    make(chan struct{}),
+			conn:      conn,
+			inputDone: make(chan struct{}),
+			sendq:     make(chan []byte, sendQueueLen),
+		}
+		srv.mu.Lock()
+		srv.sessions[s] = struct{}{}
+		srv.mu.Unlock()
+
+		// A session handed to a process belongs to that process alone, so
+		// the standard input is not sent to it.
+		if !srv.config.executes() {
+			srv.startSend.Do(func() {
+				go srv.writeTCP()
+			})
+			go srv.writeSession(s)
+		}
+		go srv.handleTCPConnection(s)
+
+		if !srv.config.keepOpen {
 			return
-		default:
-			srv.logger.Error("failed to accept listener", "error", err)
 		}
 	}
-	srv.ln.Close()
-	srv.conn = conn
+}
+
+func (srv *TCPServer) handleTCPConnection(s *tcpSession) {
+	if tlsConn, ok := s.conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			srv.logger.Error("TLS handshake failed", "remoteAddr", s.conn.RemoteAddr(), "error", err)
+			srv.closeSession(s)
+			return
+		}
+		state := tlsConn.ConnectionState()
+		srv.logger.Info("TLS handshake complete", "version", tls.VersionName(state.Version), "cipher", tls.CipherSuiteName(state.CipherSuite))
+		if srv.config.verbose {
+			printTLSState(state)
+		}
 
-	srv.logger.Info("connected to", "remoteAddr", conn.RemoteAddr())
+		if len(state.PeerCertificates) > 0 {
+			subject := state.PeerCertificates[0].Subject
+			srv.logger.Info("client authenticated", "remoteAddr", s.conn.RemoteAddr(), "subject", subject)
+			if srv.config.verbose {
+				fmt.Printf("Client [%s] authenticated as %s\n", s.conn.RemoteAddr(), subject)
+			}
+		}
+	}
+
+	if srv.config.socksServer {
+		srv.serveSOCKS(s)
+		return
+	}
+
+	if srv.config.httpProxyServer {
+		srv.serveHTTPConnect(s)
+		return
+	}
+
+	if srv.config.relay != "" {
+		srv.relayTCP(s)
+		return
+	}
+
+	if srv.config.executes() {
+		srv.executeTCPCmd(s)
+		return
+	}
+	srv.readTCP(s)
+}
+
+// relayTCP connects a client session to the relay target and splices them.
+func (srv *TCPServer) relayTCP(s *tcpSession) {
+	ep, err := srv.config.relayEndpoint("tcp")
+	if err != nil {
+		srv.logger.Error("invalid relay target", "target", srv.config.relay, "error", err)
+		srv.closeSession(s)
+		return
+	}
+
+	upstream, err := ep.open()
+	if err != nil {
+		srv.logger.Error("failed to connect to relay target", "target", ep, "error", err)
+		srv.closeSession(s)
+		return
+	}
 
+	target := streamName(upstream, ep)
+	srv.logger.Info("relaying connection", "remoteAddr", s.conn.RemoteAddr(), "target", target)
 	if srv.config.verbose {
-		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.LocalAddr(), conn.RemoteAddr(), conn.RemoteAddr().Network())
+		fmt.Printf("Relaying [%s] to [%s]\n", s.conn.RemoteAddr(), target)
+	}
+	srv.splice(s, upstream, target)
+}
+
+// splice copies data both ways between a client session and an upstream
+// stream until one of them closes, then ends the session. With -C line
+// endings going upstream become CRLF, with --crlf-recv those coming back
+// become LF.
+func (srv *TCPServer) splice(s *tcpSession, upstream io.ReadWriteCloser, target string) {
+	var toUpstream, toClient io.Writer = upstream, s.conn
+	if srv.config.crlf {
+		toUpstream = &crlfWriter{w: upstream}
+	}
+	if srv.config.crlfRecv {
+		toClient = &lfWriter{w: s.conn}
+	}
+
+	client := s.conn.RemoteAddr()
+	done := make(chan error, 2)
+	go func() {
+		done <- srv.config.pipe(toUpstream, s.conn, client, target, func(n int) { s.bytesRcvd += n })
+	}()
+	go func() {
+		done <- srv.config.pipe(toClient, upstream, target, client, func(n int) { s.bytesSent += n })
+	}()
+
+	err := <-done
+	upstream.Close()
+	s.conn.Close()
+	<-done
+
+	if isTimeout(err) {
+		srv.logger.Info("connection timed out", "remoteAddr", client, "error", err)
+		if srv.config.verbose {
+			fmt.Printf("Connection from [%s] timed out\n", client)
+		}
+	} else {
+		srv.logger.Info("client disconnected", "remoteAddr", client)
+	}
+	srv.closeSession(s)
+}
+
+// closeSession ends a single client session. Without keep-open mode the
+// server only ever has one session, so ending it stops the server.
+func (srv *TCPServer) closeSession(s *tcpSession) {
+	if !srv.config.keepOpen {
+		srv.stopTCP()
+		return
 	}
 
-	if cmd := srv.config.cmd; cmd != "" {
-		srv.executeTCPCmd(conn, cmd)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if _, ok := srv.sessions[s]; !ok {
+		return
+	}
+	delete(srv.sessions, s)
+	close(s.closed)
+	s.conn.Close()
+
+	if srv.config.verbose && !srv.config.executes() {
+		fmt.Printf("Connection from [%s] closed: sent %d, rcvd %d\n", s.conn.RemoteAddr(), s.bytesSent, s.bytesRcvd)
 	}
-	go srv.readTCP(conn)
-	go srv.writeTCP(conn)
 }
 
-func (srv *TCPServer) readTCP(conn net.Conn) {
+func (srv *TCPServer) readTCP(s *tcpSession) {
+	conn := s.conn
 	buf := make([]byte, 2048)
 	var dataRead []byte
+	var pending bool
 
 	for {
 		n, err := conn.Read(buf)
 		if err != nil {
 			if errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
 				srv.logger.Info("client disconnected", "remoteAddr", conn.RemoteAddr())
-				srv.stopTCP()
+				srv.closeSession(s)
+				return
+			}
+			if isTimeout(err) {
+				srv.logger.Info("connection timed out", "remoteAddr", conn.RemoteAddr(), "error", err)
+				if srv.config.verbose {
+					fmt.Printf("Connection from [%s] timed out\n", conn.RemoteAddr())
+				}
+				srv.closeSession(s)
 				return
 			}
 
@@ -118,50 +332,170 @@ func (srv *TCPServer) readTCP(conn net.Conn) {
 				return
 			default:
 				srv.logger.Error("failed to read from tcp connection", "error", err)
+				srv.closeSession(s)
 				return
 			}
 		}
-		srv.bytesRcvd += n
+		s.bytesRcvd += n
 		dataRead = buf[:n]
 		srv.logger.Info("received data", "remoteAddr", conn.RemoteAddr(), "bytes", n)
-		fmt.Print(string(dataRead))
+		text := srv.config.received(dataRead, &pending)
+		fmt.Print(string(text))
+		srv.config.capture.output(text)
+		srv.config.capture.dumpRecv(conn.RemoteAddr(), dataRead)
 
 		if srv.config.hex {
 			fmt.Printf("Received %d bytes from the socket\n", n)
 			fmt.Printf("%s", hex.Dump(dataRead))
 		}
 
+		if srv.config.broker {
+			srv.broadcast(s, dataRead)
+		}
+
 		if n == 0 {
 			return
 		}
 	}
 }
 
-func (srv *TCPServer) writeTCP(conn net.Conn) {
-	for msg := range srv.sendch {
-		n, err := conn.Write([]byte(msg))
+// writeTCP sends every message read from the standard input to all
+// connected clients. At the end of the input it waits for the clients to be
+// sent what was queued for them before quitting.
+func (srv *TCPServer) writeTCP() {
+	for {
+		var msg []byte
+		select {
+		case msg = <-srv.sendch:
+		case <-srv.quit:
+			return
+		}
+		if msg == nil {
+			for _, s := range srv.snapshot() {
+				srv.enqueue(s, nil)
+			}
+			for _, s := range srv.snapshot() {
+				select {
+				case <-s.inputDone:
+				case <-s.closed:
+				case <-srv.quit:
+				}
+			}
+			srv.config.quitAfterInput(srv.stopTCP)
+			continue
+		}
+		srv.broadcast(nil, msg)
+	}
+}
+
+// snapshot returns the sessions connected right now, so that they can be
+// written to without holding the lock.
+func (srv *TCPServer) snapshot() []*tcpSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	sessions := make([]*tcpSession, 0, len(srv.sessions))
+	for s := range srv.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// broadcast queues data for every connected client except the session it
+// came from, which is nil for data read from the standard input. The
+// standard input waits for a client that falls behind, while the broker
+// disconnects it so that it cannot hold up the others for long.
+func (srv *TCPServer) broadcast(from *tcpSession, data []byte) {
+	data = bytes.Clone(data)
+	for _, s := range srv.snapshot() {
+		if s == from {
+			continue
+		}
+		if from == nil {
+			srv.enqueue(s, data)
+			continue
+		}
+
+		timer := time.NewTimer(sendQueueTimeout)
+		select {
+		case s.sendq <- data:
+		case <-s.closed:
+		case <-srv.quit:
+		case <-timer.C:
+			srv.logger.Error("client is not reading, disconnecting", "remoteAddr", s.conn.RemoteAddr())
+			srv.closeSession(s)
+		}
+		timer.Stop()
+	}
+}
+
+// enqueue queues data for a session, waiting for room unless the session or
+// the server closes first. A nil message marks the end of the input.
+func (srv *TCPServer) enqueue(s *tcpSession, data []byte) {
+	select {
+	case s.sendq <- data:
+	case <-s.closed:
+	case <-srv.quit:
+	}
+}
+
+// writeSession writes the messages queued for a session to its connection
+// until the session or the server closes.
+func (srv *TCPServer) writeSession(s *tcpSession) {
+	conn := s.conn
+	inputDone := false
+	defer func() {
+		if !inputDone {
+			close(s.inputDone)
+		}
+	}()
+
+	for {
+		var data []byte
+		select {
+		case data = <-s.sendq:
+		case <-s.closed:
+			return
+		case <-srv.quit:
+			return
+		}
+
+		if data == nil {
+			if srv.config.halfClose {
+				closeWrite(conn)
+			}
+			if !inputDone {
+				inputDone = true
+				close(s.inputDone)
+			}
+			continue
+		}
+
+		n, err := conn.Write(data)
 		if err != nil {
 			srv.logger.Error("failed to write to tcp connection", "error", err)
-			return
+			continue
 		}
-		srv.bytesSent += n
+		s.bytesSent += n
 		srv.logger.Info("message sent to client", "remoteAddr", conn.RemoteAddr())
+		srv.config.capture.dumpSent(conn.RemoteAddr(), data)
 
 		if srv.config.hex {
 			fmt.Printf("Sent %d bytes to the socket\n", n)
-			fmt.Printf("%s", hex.Dump([]byte(msg)))
+			fmt.Printf("%s", hex.Dump(data))
 		}
 	}
 }
 
-func (srv *TCPServer) executeTCPCmd(conn net.Conn, cmd string) {
-	c := exec.Command(cmd)
-	c.Stdin = conn
-	c.Stdout = conn
-	c.Stderr = conn
-
-	if err := c.Run(); err != nil {
-		srv.logger.Error("failed to run command", "error", err)
-		os.Exit(1)
+// executeTCPCmd runs a process of its own for a client session, which ends
+// when the process exits.
+func (srv *TCPServer) executeTCPCmd(s *tcpSession) {
+	conn := s.conn
+	c, err := srv.config.command()
+	if err == nil {
+		c.Env = commandEnv(conn.LocalAddr(), conn.RemoteAddr())
+		err = srv.config.runCommand(c, conn)
 	}
+	srv.config.reportExit(srv.logger, c, err, "remoteAddr", conn.RemoteAddr())
+	srv.closeSession(s)
 }
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -108,7 +112,7 @@ func TestTCPMessaging(t *testing.T) {
 
 		time.Sleep(50 * time.Millisecond)
 		msg := "hello from the server\n"
-		srv.sendch <- msg
+		srv.sendch <- []byte(msg)
 
 		buf := make([]byte, 1024)
 		n, err := clientConn.Read(buf)
@@ -184,6 +188,412 @@ msg="TCP server shutdown successfully"
 	assert.Equal(t, expected, logBuf.String())
 }
 
+func TestTCPKeepOpen(t *testing.T) {
+	var wg sync.WaitGroup
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{verbose: true, keepOpen: true, port: 3010},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer(":3010")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+
+	var actualMsgs []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		first, err := net.Dial("tcp", srv.lAddrStr)
+		assert.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		first.Close()
+
+		time.Sleep(50 * time.Millisecond)
+		second, err := net.Dial("tcp", srv.lAddrStr)
+		assert.NoError(t, err)
+		third, err := net.Dial("tcp", srv.lAddrStr)
+		assert.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+		srv.sendch <- []byte("hello from the server\n")
+
+		for _, conn := range []net.Conn{second, third} {
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			assert.NoError(t, err)
+			actualMsgs = append(actualMsgs, string(buf[:n]))
+		}
+
+		srv.stopTCP()
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="client disconnected"
+msg="connected to"
+msg="connected to"
+msg="message sent to client"
+msg="message sent to client"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"hello from the server\n", "hello from the server\n"}, actualMsgs)
+}
+
+func TestTCPBroker(t *testing.T) {
+	var wg sync.WaitGroup
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{broker: true, keepOpen: true, port: 3011},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer(":3011")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+
+	var actualMsgs []string
+	var senderMsg string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		var conns []net.Conn
+		for i := 0; i < 3; i++ {
+			conn, err := net.Dial("tcp", srv.lAddrStr)
+			assert.NoError(t, err)
+			conns = append(conns, conn)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintln(conns[0], "hello from the 1st client")
+
+		for _, conn := range conns[1:] {
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			assert.NoError(t, err)
+			actualMsgs = append(actualMsgs, string(buf[:n]))
+		}
+
+		srv.sendch <- []byte("hello from the server\n")
+		buf := make([]byte, 1024)
+		n, err := conns[0].Read(buf)
+		assert.NoError(t, err)
+		senderMsg = string(buf[:n])
+
+		srv.stopTCP()
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="connected to"
+msg="connected to"
+msg="received data"
+msg="message sent to client"
+msg="message sent to client"
+msg="message sent to client"
+msg="message sent to client"
+msg="message sent to client"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"hello from the 1st client\n", "hello from the 1st client\n"}, actualMsgs)
+	assert.Equal(t, "hello from the server\n", senderMsg)
+}
+
+func TestTCPBrokerSlowClient(t *testing.T) {
+	// The server prints everything it receives.
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{broker: true, keepOpen: true},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer(":3092")
+	done := make(chan error)
+	go func() {
+		done <- srv.StartTCP()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	sender, err := net.Dial("tcp", srv.lAddrStr)
+	assert.NoError(t, err)
+	defer sender.Close()
+	reader, err := net.Dial("tcp", srv.lAddrStr)
+	assert.NoError(t, err)
+	defer reader.Close()
+	// The slow client never reads what it is sent.
+	slow, err := net.Dial("tcp", srv.lAddrStr)
+	assert.NoError(t, err)
+	defer slow.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	chunk := bytes.Repeat([]byte("x"), 2048)
+	total := len(chunk) * 4096
+	received := make(chan error)
+	go func() {
+		_, err := io.ReadFull(reader, make([]byte, total))
+		received <- err
+	}()
+
+	for i := 0; i < 4096; i++ {
+		_, err := sender.Write(chunk)
+		assert.NoError(t, err)
+	}
+
+	// The client that reads gets everything despite the one that does not.
+	select {
+	case err := <-received:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("data was not relayed")
+	}
+
+	srv.stopTCP()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not stop")
+	}
+
+	assert.Contains(t, logBuf.String(), `msg="client is not reading, disconnecting"`)
+}
+
+func TestTCPBindAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   config
+		lHost    string
+		expected string
+	}{
+		{
+			name:     "Bind IPv4 Loopback",
+			config:   config{port: 3012},
+			lHost:    "127.0.0.1:3012",
+			expected: "127.0.0.1:3012",
+		},
+		{
+			name:     "Force IPv4",
+			config:   config{ipv4: true, port: 3013},
+			lHost:    ":3013",
+			expected: "0.0.0.0:3013",
+		},
+		{
+			name:     "Force IPv6",
+			config:   config{ipv6: true, port: 3014},
+			lHost:    "[::1]:3014",
+			expected: "[::1]:3014",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := createTestSlog()
+
+			app := &application{
+				config: tt.config,
+				logger: logger,
+			}
+
+			srv := app.NewTCPServer(tt.lHost)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, tt.expected, srv.ln.Addr().String())
+
+			conn, err := net.Dial("tcp", tt.expected)
+			assert.NoError(t, err)
+			conn.Close()
+		})
+	}
+}
+
+func TestUnixStreamSocket(t *testing.T) {
+	tests := []struct {
+		name string
+		path func(t *testing.T) string
+	}{
+		{
+			name: "Socket File",
+			path: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "gonc.sock")
+			},
+		},
+		{
+			name: "Abstract Namespace",
+			path: func(t *testing.T) string {
+				return "@gonc-test-" + strconv.Itoa(os.Getpid())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+
+			path := tt.path(t)
+			logger, logBuf := createTestSlog()
+
+			app := &application{
+				config: config{unix: true},
+				logger: logger,
+			}
+
+			srv := app.NewTCPServer(path)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+
+			var actualMsg string
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(50 * time.Millisecond)
+
+				conn, err := net.Dial("unix", path)
+				assert.NoError(t, err)
+
+				fmt.Fprintln(conn, "hello from the client")
+
+				time.Sleep(50 * time.Millisecond)
+				srv.sendch <- []byte("hello from the server\n")
+
+				buf := make([]byte, 1024)
+				n, err := conn.Read(buf)
+				assert.NoError(t, err)
+				actualMsg = string(buf[:n])
+
+				conn.Close()
+			}()
+
+			wg.Wait()
+			time.Sleep(250 * time.Millisecond)
+
+			expected := `msg="starting TCP server"
+msg="connected to"
+msg="received data"
+msg="message sent to client"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+			assert.Equal(t, expected, logBuf.String())
+			assert.Equal(t, "hello from the server\n", actualMsg)
+
+			if !strings.HasPrefix(path, "@") {
+				_, err := os.Stat(path)
+				assert.True(t, os.IsNotExist(err), "expected the socket file to be removed")
+			}
+		})
+	}
+}
+
+func TestTCPRelay(t *testing.T) {
+	var wg sync.WaitGroup
+
+	target, err := net.Listen("tcp", "localhost:3072")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				n, _ := conn.Read(buf)
+				fmt.Fprintf(conn, "echo: %s", buf[:n])
+			}()
+		}
+	}()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, relay: "localhost:3072"},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("localhost:3071")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+
+	var actual []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		for _, msg := range []string{"1st client\n", "2nd client\n"} {
+			conn, err := net.Dial("tcp", "localhost:3071")
+			assert.NoError(t, err)
+			fmt.Fprint(conn, msg)
+
+			buf := make([]byte, 1024)
+			n, err := conn.Read(buf)
+			assert.NoError(t, err)
+			actual = append(actual, string(buf[:n]))
+			conn.Close()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+
+	srv.mu.Lock()
+	assert.Empty(t, srv.sessions)
+	srv.mu.Unlock()
+
+	srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="relaying connection"
+msg="client disconnected"
+msg="connected to"
+msg="relaying connection"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"echo: 1st client\n", "echo: 2nd client\n"}, actual)
+}
+
 func TestExecuteTCPCmd(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -201,7 +611,7 @@ func TestExecuteTCPCmd(t *testing.T) {
 			name:     "List Directory",
 			cmd:      "ls",
 			port:     3007,
-			expected: "helper.go\nmain.go\nscan.go\nscan_test.go\ntcpServer.go\ntcpServer_test.go\nudpServer.go\nudpServer_test.go\n",
+			expected: "bridge.go\nbridge_test.go\ncapture.go\ncapture_test.go\ncrlf.go\ncrlf_test.go\nendpoint.go\nendpoint_test.go\nexec.go\nexec_test.go\nfifo_other.go\nfifo_unix.go\nhelper.go\nhttpProxyServer.go\nhttpProxyServer_test.go\nmain.go\nmain_test.go\nproxy.go\nproxy_test.go\npty.go\npty_linux.go\npty_linux_test.go\npty_other.go\npty_test.go\nscan.go\nscan_test.go\nsocksServer.go\nsocksServer_test.go\ntcpClient.go\ntcpClient_test.go\ntcpServer.go\ntcpServer_test.go\ntimeout.go\ntimeout_test.go\ntls.go\ntls_test.go\nudpClient.go\nudpClient_test.go\nudpServer.go\nudpServer_test.go\n",
 		},
 		// fails when run with global test command??
 		// {
@@ -250,3 +660,353 @@ func TestExecuteTCPCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteTCPCmdArguments(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   config
+		port     int
+		expected string
+	}{
+		{
+			name:     "Program With Arguments",
+			config:   config{cmd: "/bin/cat -n"},
+			port:     3075,
+			expected: "     1\tHello\n",
+		},
+		{
+			name:     "Shell Command",
+			config:   config{shExec: `read line; echo "got $line"`},
+			port:     3076,
+			expected: "got Hello\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := createTestSlog()
+
+			app := &application{config: tt.config, logger: logger}
+
+			srv := app.NewTCPServer(":" + strconv.Itoa(tt.port))
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			clientConn, err := net.Dial("tcp", srv.lAddrStr)
+			assert.NoError(t, err)
+			defer clientConn.Close()
+			fmt.Fprintln(clientConn, "Hello")
+
+			buf := make([]byte, 1024)
+			n, err := clientConn.Read(buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(buf[:n]))
+		})
+	}
+}
+
+func TestExecuteTCPCmdPerConnection(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, shExec: `echo "$GONC_PROTO $GONC_REMOTE_ADDR:$GONC_REMOTE_PORT $GONC_LOCAL_ADDR:$GONC_LOCAL_PORT"`},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3077")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:3077")
+		assert.NoError(t, err)
+
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		assert.NoError(t, err)
+		expected := fmt.Sprintf("tcp %s 127.0.0.1:3077\n", conn.LocalAddr())
+		assert.Equal(t, expected, string(buf[:n]))
+
+		// The session ends with its process.
+		_, err = conn.Read(buf)
+		assert.Error(t, err)
+		conn.Close()
+	}
+
+	srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="command exited"
+msg="connected to"
+msg="command exited"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestExecuteTCPCmdNoInput(t *testing.T) {
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, shExec: "sleep 0.3"},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("127.0.0.1:3099")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	defer srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:3099")
+	assert.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// The standard input of gonc is not sent to the process's peer.
+	sent := make(chan bool)
+	go func() {
+		select {
+		case srv.sendch <- []byte("from the standard input\n"):
+			sent <- true
+		case <-time.After(100 * time.Millisecond):
+			sent <- false
+		}
+	}()
+
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Empty(t, string(data))
+	assert.False(t, <-sent)
+}
+
+func TestExecuteTCPCmdStderr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stderr.log")
+
+	tests := []struct {
+		name           string
+		execStderr     string
+		port           int
+		expected       string
+		expectedStderr string
+	}{
+		{
+			name:       "Merged Into Socket",
+			execStderr: "socket",
+			port:       3079,
+			expected:   "out\nerr\n",
+		},
+		{
+			name:           "Log File",
+			execStderr:     path,
+			port:           3080,
+			expected:       "out\n",
+			expectedStderr: "err\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logBuf := createTestSlog()
+			app := &application{
+				config: config{keepOpen: true, execStderr: tt.execStderr, shExec: `echo out; sleep 0.01; echo err >&2; exit 3`},
+				logger: logger,
+			}
+
+			srv := app.NewTCPServer(":" + strconv.Itoa(tt.port))
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			// A failing process ends its own session, not the listener.
+			for i := 0; i < 2; i++ {
+				conn, err := net.Dial("tcp", srv.lAddrStr)
+				assert.NoError(t, err)
+
+				var actual strings.Builder
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					actual.Write(buf[:n])
+					if err != nil {
+						break
+					}
+				}
+				conn.Close()
+				assert.Equal(t, tt.expected, actual.String())
+			}
+
+			srv.stopTCP()
+			time.Sleep(50 * time.Millisecond)
+
+			expected := `msg="starting TCP server"
+msg="connected to"
+msg="command exited"
+msg="connected to"
+msg="command exited"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+			assert.Equal(t, expected, logBuf.String())
+
+			if tt.expectedStderr != "" {
+				data, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStderr+tt.expectedStderr, string(data))
+			}
+		})
+	}
+}
+
+func TestTCPServerHalfClose(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{halfClose: true, quitDelay: -1},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer(":3082")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", srv.lAddrStr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	srv.sendch <- []byte("hello from the server\n")
+	srv.sendch <- nil
+
+	// The client sees the end of the stream but can still answer.
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello from the server\n", string(data))
+
+	_, err = conn.Write([]byte("hello from the client\n"))
+	assert.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="message sent to client"
+msg="received data"
+msg="client disconnected"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestTCPServerAcceptTimeout(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{config: config{wait: 1}, logger: logger}
+
+	srv := app.NewTCPServer(":3083")
+	err := srv.StartTCP()
+	assert.True(t, isTimeout(err))
+
+	expected := `msg="starting TCP server"
+msg="timed out waiting for a connection" error="no connection within 1s: accept tcp [::]:3083: i/o timeout"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestTCPServerIdleTimeout(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, idleTimeout: 100 * time.Millisecond},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer(":3084")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", srv.lAddrStr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	// A chatty client stays connected, a silent one is dropped.
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprintf(conn, "message %d\n", i)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 16))
+	assert.ErrorIs(t, err, io.EOF)
+
+	srv.stopTCP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting TCP server"
+msg="connected to"
+msg="received data"
+msg="received data"
+msg="received data"
+msg="connection timed out" error="read tcp 127.0.0.1:3084->127.0.0.1:` + strings.Split(conn.LocalAddr().String(), ":")[1] + `: i/o timeout"
+msg="stopping TCP connection"
+msg="TCP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestTCPRelayCRLF(t *testing.T) {
+	target, err := net.Listen("tcp", "localhost:3090")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		n, _ := conn.Read(buf)
+		fmt.Fprintf(conn, "got %q\r\n", buf[:n])
+	}()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{crlf: true, crlfRecv: true, relay: "localhost:3090"},
+		logger: logger,
+	}
+
+	srv := app.NewTCPServer("localhost:3089")
+	go func() {
+		err := srv.StartTCP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", "localhost:3089")
+	assert.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprint(conn, "PING\n")
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	actual, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "got \"PING\\r\\n\"\n", string(actual))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// waitTimeout returns the connect and accept timeout given with -w, or zero
+// for no limit.
+func (cfg config) waitTimeout() time.Duration {
+	return time.Duration(cfg.wait) * time.Second
+}
+
+// idle wraps conn so that it times out after --idle-timeout without data
+// going either way. Without an idle timeout conn is returned as is.
+func (cfg config) idle(conn net.Conn) net.Conn {
+	if cfg.idleTimeout <= 0 {
+		return conn
+	}
+	conn.SetDeadline(time.Now().Add(cfg.idleTimeout))
+	return &idleConn{Conn: conn, timeout: cfg.idleTimeout}
+}
+
+// idleConn is a connection whose deadline moves forward with every read and
+// write, so that reads fail with os.ErrDeadlineExceeded once it has been
+// idle for the timeout.
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.Conn.SetDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(b)
+}
+
+// CloseWrite shuts down the write side of the underlying connection.
+func (c *idleConn) CloseWrite() error {
+	closeWrite(c.Conn)
+	return nil
+}
+
+// timeoutListener stops accepting when nobody connects within the accept
+// timeout of -w, and hands out connections that time out when idle.
+type timeoutListener struct {
+	net.Listener
+	accepted bool
+	cfg      config
+}
+
+// timeoutListener wraps ln in a timeoutListener when -w or --idle-timeout
+// is given. The accept timeout starts right away.
+func (cfg config) timeoutListener(ln net.Listener) net.Listener {
+	if cfg.wait <= 0 && cfg.idleTimeout <= 0 {
+		return ln
+	}
+	if cfg.wait > 0 {
+		setDeadline(ln, time.Now().Add(cfg.waitTimeout()))
+	}
+	return &timeoutListener{Listener: ln, cfg: cfg}
+}
+
+// Accept waits for the next connection. Only the first connection has to
+// come within the accept timeout.
+func (l *timeoutListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		if isTimeout(err) {
+			err = fmt.Errorf("no connection within %s: %w", l.cfg.waitTimeout(), err)
+		}
+		return nil, err
+	}
+	if !l.accepted {
+		l.accepted = true
+		setDeadline(l.Listener, time.Time{})
+	}
+	return l.cfg.idle(conn), nil
+}
+
+// setDeadline sets the accept deadline of listeners that support one.
+func setDeadline(ln net.Listener, t time.Time) {
+	if dl, ok := ln.(interface{ SetDeadline(time.Time) error }); ok {
+		dl.SetDeadline(t)
+	}
+}
+
+// isTimeout reports whether err is a timeout of a dial, accept or read.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
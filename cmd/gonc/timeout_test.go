@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleConn(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	cfg := config{idleTimeout: 100 * time.Millisecond}
+	conn := cfg.idle(local)
+
+	// Traffic either way keeps the connection alive.
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		_, err := conn.Write([]byte("ping"))
+		assert.NoError(t, err)
+	}
+
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 16))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded))
+	assert.True(t, isTimeout(err))
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	assert.Equal(t, local, config{}.idle(local))
+}
+
+func TestTimeoutListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	cfg := config{wait: 1, idleTimeout: time.Minute}
+	tl := cfg.timeoutListener(ln)
+
+	go func() {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+		time.Sleep(1500 * time.Millisecond)
+	}()
+
+	// The first connection arrives in time; later ones may take longer.
+	conn, err := tl.Accept()
+	assert.NoError(t, err)
+	assert.IsType(t, &idleConn{}, conn)
+	conn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tl.Accept()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("accept returned early: %v", err)
+	case <-time.After(1500 * time.Millisecond):
+	}
+	ln.Close()
+	assert.Error(t, <-done)
+
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	_, err = config{wait: 1}.timeoutListener(ln).Accept()
+	assert.True(t, isTimeout(err))
+	assert.ErrorContains(t, err, "no connection within 1s")
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// serverTLSConfig builds the TLS configuration of a listener. Without
+// --ssl-cert and --ssl-key a self-signed certificate is generated. With
+// --ssl-client-ca clients must present a certificate signed by that CA,
+// and with --ssl-allow its subject must be in the allowed list.
+func (cfg config) serverTLSConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	switch {
+	case cfg.sslCert != "" && cfg.sslKey != "":
+		cert, err = tls.LoadX509KeyPair(cfg.sslCert, cfg.sslKey)
+	case cfg.sslCert != "" || cfg.sslKey != "":
+		err = errors.New("both --ssl-cert and --ssl-key are required")
+	default:
+		cert, err = generateSelfSignedCert([]string{"localhost", "127.0.0.1", "::1"})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   cfg.alpnProtocols(),
+	}
+
+	if cfg.sslClientCA != "" {
+		pool, err := loadCertPool(cfg.sslClientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = pool
+	}
+
+	if len(cfg.sslAllow) > 0 {
+		if cfg.sslClientCA == "" {
+			return nil, errors.New("--ssl-allow requires --ssl-client-ca")
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("no client certificate")
+			}
+			cert := state.PeerCertificates[0]
+			if !certMatches(cert, cfg.sslAllow) {
+				return fmt.Errorf("client certificate %q is not allowed", cert.Subject)
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// clientTLSConfig builds the TLS configuration used to connect to host. The
+// server certificate is only verified with --ssl-verify.
+func (cfg config) clientTLSConfig(host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !cfg.sslVerify,
+		NextProtos:         cfg.alpnProtocols(),
+		ServerName:         host,
+	}
+	if cfg.sslServerName != "" {
+		tlsConfig.ServerName = cfg.sslServerName
+	}
+
+	if cfg.sslTrustFile != "" {
+		pool, err := loadCertPool(cfg.sslTrustFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.sslCert != "" && cfg.sslKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.sslCert, cfg.sslKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (cfg config) alpnProtocols() []string {
+	if cfg.sslALPN == "" {
+		return nil
+	}
+	return strings.Split(cfg.sslALPN, ",")
+}
+
+// certMatches reports whether the subject common name or one of the subject
+// alternative names of cert is in names.
+func certMatches(cert *x509.Certificate, names []string) bool {
+	candidates := []string{cert.Subject.CommonName}
+	candidates = append(candidates, cert.DNSNames...)
+	candidates = append(candidates, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		candidates = append(candidates, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		candidates = append(candidates, uri.String())
+	}
+
+	for _, c := range candidates {
+		if c != "" && slices.Contains(names, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadCertPool reads the PEM encoded certificates of a CA file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
+
+// generateSelfSignedCert creates a short lived certificate for the given
+// host names and IP addresses.
+func generateSelfSignedCert(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "gonc"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// printTLSState prints the negotiated TLS parameters and the peer
+// certificate chain.
+func printTLSState(state tls.ConnectionState) {
+	fmt.Printf("TLS session: %s, cipher %s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if state.NegotiatedProtocol != "" {
+		fmt.Printf(", ALPN %s", state.NegotiatedProtocol)
+	}
+	fmt.Println()
+
+	for i, cert := range state.PeerCertificates {
+		fmt.Printf(" %d s:%s\n   i:%s\n", i, cert.Subject, cert.Issuer)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSMessaging(t *testing.T) {
+	dir := t.TempDir()
+	cert, err := generateSelfSignedCert([]string{"localhost", "127.0.0.1"})
+	assert.NoError(t, err)
+	writeTestCert(t, dir, cert)
+
+	tests := []struct {
+		name         string
+		port         int
+		serverConfig config
+		clientConfig config
+		expectedALPN string
+		expectedErr  bool
+	}{
+		{
+			name:         "Self-Signed Without Verification",
+			port:         3020,
+			serverConfig: config{ssl: true},
+			clientConfig: config{ssl: true},
+		},
+		{
+			name:         "Verified With Trust File",
+			port:         3021,
+			serverConfig: config{ssl: true, sslCert: filepath.Join(dir, "cert.pem"), sslKey: filepath.Join(dir, "key.pem")},
+			clientConfig: config{ssl: true, sslVerify: true, sslTrustFile: filepath.Join(dir, "cert.pem")},
+		},
+		{
+			name:         "Verification Fails Without Trust File",
+			port:         3022,
+			serverConfig: config{ssl: true},
+			clientConfig: config{ssl: true, sslVerify: true},
+			expectedErr:  true,
+		},
+		{
+			name:         "Verification Fails For Wrong Server Name",
+			port:         3023,
+			serverConfig: config{ssl: true, sslCert: filepath.Join(dir, "cert.pem"), sslKey: filepath.Join(dir, "key.pem")},
+			clientConfig: config{ssl: true, sslVerify: true, sslTrustFile: filepath.Join(dir, "cert.pem"), sslServerName: "example.com"},
+			expectedErr:  true,
+		},
+		{
+			name:         "Negotiate ALPN",
+			port:         3024,
+			serverConfig: config{ssl: true, sslALPN: "h2,http/1.1"},
+			clientConfig: config{ssl: true, sslALPN: "http/1.1"},
+			expectedALPN: "http/1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, _ := createTestSlog()
+			srvApp := &application{config: tt.serverConfig, logger: logger}
+
+			addr := "localhost:" + strconv.Itoa(tt.port)
+			srv := srvApp.NewTCPServer(addr)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			clientLogger, clientLogBuf := createTestSlog()
+			clientApp := &application{config: tt.clientConfig, logger: clientLogger}
+
+			client := clientApp.NewTCPClient(addr)
+			errch := make(chan error, 1)
+			go func() {
+				errch <- client.StartTCPClient()
+			}()
+
+			if tt.expectedErr {
+				assert.Error(t, <-errch)
+				srv.stopTCP()
+				return
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			srv.sendch <- []byte("hello from the server\n")
+			time.Sleep(50 * time.Millisecond)
+
+			state := client.conn.(*tls.Conn).ConnectionState()
+			assert.Equal(t, tt.expectedALPN, state.NegotiatedProtocol)
+
+			client.stopTCPClient()
+			assert.NoError(t, <-errch)
+
+			expected := `msg="connected to TCP server"
+msg="TLS handshake complete"
+msg="received data"
+msg="stopping TCP client"
+msg="TCP client shutdown successfully"
+`
+			assert.Equal(t, expected, clientLogBuf.String())
+			srv.stopTCP()
+		})
+	}
+}
+
+func writeTestCert(t *testing.T, dir string, cert tls.Certificate) {
+	t.Helper()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0o600))
+
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0o600))
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := generateSelfSignedCert([]string{"localhost"})
+	assert.NoError(t, err)
+	caDir := filepath.Join(dir, "ca")
+	assert.NoError(t, os.Mkdir(caDir, 0o700))
+	writeTestCert(t, caDir, ca)
+
+	for _, name := range []string{"alice", "mallory"} {
+		certDir := filepath.Join(dir, name)
+		assert.NoError(t, os.Mkdir(certDir, 0o700))
+		writeTestCert(t, certDir, signTestCert(t, ca, name, name+".example.com"))
+	}
+
+	otherCA, err := generateSelfSignedCert([]string{"localhost"})
+	assert.NoError(t, err)
+	otherDir := filepath.Join(dir, "other")
+	assert.NoError(t, os.Mkdir(otherDir, 0o700))
+	writeTestCert(t, otherDir, signTestCert(t, otherCA, "alice", "alice.example.com"))
+
+	tests := []struct {
+		name        string
+		port        int
+		allow       []string
+		clientDir   string
+		expectedErr string
+	}{
+		{
+			name:      "Client Certificate Signed By CA",
+			port:      3025,
+			clientDir: "alice",
+		},
+		{
+			name:      "Allowed By Subject Alternative Name",
+			port:      3026,
+			allow:     []string{"bob", "alice.example.com"},
+			clientDir: "alice",
+		},
+		{
+			name:        "Rejected By Allow List",
+			port:        3027,
+			allow:       []string{"alice"},
+			clientDir:   "mallory",
+			expectedErr: `client certificate \"CN=mallory\" is not allowed`,
+		},
+		{
+			name:        "Rejected Without Client Certificate",
+			port:        3028,
+			expectedErr: "client didn't provide a certificate",
+		},
+		{
+			name:        "Rejected For Unknown CA",
+			port:        3029,
+			clientDir:   "other",
+			expectedErr: "certificate signed by unknown authority",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logBuf := createTestSlog()
+			srvApp := &application{
+				config: config{ssl: true, sslClientCA: filepath.Join(caDir, "cert.pem"), sslAllow: tt.allow},
+				logger: logger,
+			}
+
+			addr := "localhost:" + strconv.Itoa(tt.port)
+			srv := srvApp.NewTCPServer(addr)
+			go func() {
+				err := srv.StartTCP()
+				assert.NoError(t, err)
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			clientConfig := config{ssl: true}
+			if tt.clientDir != "" {
+				clientConfig.sslCert = filepath.Join(dir, tt.clientDir, "cert.pem")
+				clientConfig.sslKey = filepath.Join(dir, tt.clientDir, "key.pem")
+			}
+			clientLogger, _ := createTestSlog()
+			clientApp := &application{config: clientConfig, logger: clientLogger}
+
+			client := clientApp.NewTCPClient(addr)
+			go func() {
+				client.StartTCPClient()
+			}()
+			time.Sleep(100 * time.Millisecond)
+
+			if tt.expectedErr != "" {
+				assert.Contains(t, logBuf.String(), `msg="TLS handshake failed"`)
+				assert.Contains(t, logBuf.String(), tt.expectedErr)
+				assert.NotContains(t, logBuf.String(), `msg="client authenticated"`)
+				return
+			}
+
+			expected := `msg="starting TCP server"
+msg="connected to"
+msg="TLS handshake complete"
+msg="client authenticated"
+`
+			assert.Equal(t, expected, logBuf.String())
+			client.stopTCPClient()
+			srv.stopTCP()
+		})
+	}
+}
+
+func signTestCert(t *testing.T, ca tls.Certificate, cn, dnsName string) tls.Certificate {
+	t.Helper()
+
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	assert.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, caCert, &key.PublicKey, ca.PrivateKey)
+	assert.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
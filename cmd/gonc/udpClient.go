@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type UDPClient struct {
+	bytesRcvd int
+	bytesSent int
+	config    config
+	conn      net.Conn
+	rAddrStr  string
+	quit      chan interface{}
+	sendch    chan []byte
+	logger    *slog.Logger
+	mu        sync.Mutex
+}
+
+func (app *application) NewUDPClient(addr string) *UDPClient {
+	return &UDPClient{
+		config:   app.config,
+		rAddrStr: addr,
+		logger:   app.logger,
+		quit:     make(chan interface{}),
+		sendch:   make(chan []byte),
+	}
+}
+
+func (c *UDPClient) StartUDPClient() error {
+	network := c.config.network("udp")
+	d, err := c.config.dialer(network)
+	if err != nil {
+		return err
+	}
+	if network == "unixgram" {
+		// Unix datagram peers can only reply to a client bound to a name.
+		name := fmt.Sprintf("gonc-%d-%d.sock", os.Getpid(), time.Now().UnixNano())
+		d.LocalAddr = &net.UnixAddr{Name: filepath.Join(os.TempDir(), name), Net: network}
+	}
+
+	conn, err := d.Dial(network, c.rAddrStr)
+	if err != nil {
+		return err
+	}
+	conn = c.config.idle(conn)
+	c.conn = conn
+
+	c.logger.Info("starting UDP client", "rAddr", conn.RemoteAddr())
+	if c.config.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.RemoteAddr(), conn.LocalAddr(), conn.RemoteAddr().Network())
+	}
+
+	go c.stopOsSignal()
+
+	if c.config.executes() {
+		go c.executeUDPCmd(conn)
+	} else {
+		go c.readUDP(conn)
+		go c.writeUDP(conn)
+	}
+
+	<-c.quit
+	c.logger.Info("UDP client shutdown successfully")
+	return nil
+}
+
+func (c *UDPClient) stopUDPClient() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.quit:
+		return
+	default:
+	}
+
+	if c.config.verbose && !c.config.executes() {
+		fmt.Printf(" sent %d, rcvd %d\n", c.bytesSent, c.bytesRcvd)
+	}
+	c.logger.Info("stopping UDP client")
+	close(c.quit)
+	c.conn.Close()
+	removeSocketFile(c.conn.LocalAddr())
+}
+
+func (c *UDPClient) readUDP(conn net.Conn) {
+	buf := make([]byte, 2048)
+	var dataRead []byte
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+				fmt.Print("Connection refused: ")
+				c.stopUDPClient()
+				return
+			}
+			if isTimeout(err) {
+				c.logger.Info("connection timed out", "rAddr", conn.RemoteAddr(), "error", err)
+				if c.config.verbose {
+					fmt.Printf("Connection to [%s] timed out\n", conn.RemoteAddr())
+				}
+				c.stopUDPClient()
+				return
+			}
+
+			select {
+			case <-c.quit:
+				return
+			default:
+				c.logger.Error("failed to read from UDP connection", "rAddr", conn.RemoteAddr(), "error", err)
+				return
+			}
+		}
+		c.bytesRcvd += n
+		dataRead = buf[:n]
+		c.logger.Info("received data from the server", "addr", conn.RemoteAddr(), "byte", n)
+		text := c.config.received(dataRead, nil)
+		fmt.Print(string(text))
+		c.config.capture.output(text)
+		c.config.capture.dumpRecv(conn.RemoteAddr(), dataRead)
+
+		if c.config.hex {
+			fmt.Printf("Received %d bytes from the socket\n", n)
+			fmt.Printf("%s", hex.Dump(dataRead))
+		}
+	}
+}
+
+func (c *UDPClient) writeUDP(conn net.Conn) {
+	for {
+		var msg []byte
+		select {
+		case msg = <-c.sendch:
+		case <-c.quit:
+			return
+		}
+		if msg == nil {
+			c.config.quitAfterInput(c.stopUDPClient)
+			continue
+		}
+
+		n, err := conn.Write(msg)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+				fmt.Print("Connection refused: ")
+				c.stopUDPClient()
+				return
+			}
+			c.logger.Error("failed to write to UDP connection", "rAddr", conn.RemoteAddr(), "error", err)
+			return
+		}
+		c.bytesSent += n
+		c.logger.Info("sending message to server", "remoteAddr", conn.RemoteAddr())
+		c.config.capture.dumpSent(conn.RemoteAddr(), msg)
+		if c.config.hex {
+			fmt.Printf("Sent %d bytes to the socket\n", n)
+			fmt.Printf("%s", hex.Dump(msg))
+		}
+	}
+}
+
+// executeUDPCmd feeds the datagrams of the server to the standard input of
+// the process and sends every chunk of its output back as a datagram.
+func (c *UDPClient) executeUDPCmd(conn net.Conn) {
+	e, err := c.config.command()
+	if err == nil {
+		e.Env = commandEnv(conn.LocalAddr(), conn.RemoteAddr())
+		err = c.config.runCommand(e, conn)
+	}
+	c.config.reportExit(c.logger, e, err)
+	c.stopUDPClient()
+}
+
+func (c *UDPClient) stopOsSignal() {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case s := <-sigch:
+		c.logger.Info("received operating system signal", "sig", s)
+		c.stopUDPClient()
+	case <-c.quit:
+		signal.Stop(sigch)
+	}
+}
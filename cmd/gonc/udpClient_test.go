@@ -0,0 +1,247 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPClientMessaging(t *testing.T) {
+	var wg sync.WaitGroup
+
+	lAddr, err := net.ResolveUDPAddr("udp", "localhost:7100")
+	assert.NoError(t, err)
+	ln, err := net.ListenUDP("udp", lAddr)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{verbose: true, hex: true},
+		logger: logger,
+	}
+
+	client := app.NewUDPClient("localhost:7100")
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+	}()
+
+	var actualMsg string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+		client.sendch <- []byte("Hello from the client\n")
+
+		buf := make([]byte, 1024)
+		n, rAddr, err := ln.ReadFromUDP(buf)
+		assert.NoError(t, err)
+		actualMsg = string(buf[:n])
+
+		_, err = ln.WriteToUDP([]byte("Hello from the server\n"), rAddr)
+		assert.NoError(t, err)
+
+		time.Sleep(50 * time.Millisecond)
+		client.stopUDPClient()
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting UDP client"
+msg="sending message to server"
+msg="received data from the server"
+msg="stopping UDP client"
+msg="UDP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, "Hello from the client\n", actualMsg)
+}
+
+func TestUDPClientConnectionRefused(t *testing.T) {
+	var wg sync.WaitGroup
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{verbose: true},
+		logger: logger,
+	}
+
+	client := app.NewUDPClient("localhost:7101")
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+		client.sendch <- []byte("Hello from the client\n")
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting UDP client"
+msg="sending message to server"
+msg="stopping UDP client"
+msg="UDP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUDPClientExecuteCmd(t *testing.T) {
+	lAddr, err := net.ResolveUDPAddr("udp", "localhost:7102")
+	assert.NoError(t, err)
+	ln, err := net.ListenUDP("udp", lAddr)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{shExec: `echo hello; read line; echo "got $line"`},
+		logger: logger,
+	}
+
+	client := app.NewUDPClient("localhost:7102")
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+	}()
+
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	n, rAddr, err := ln.ReadFromUDP(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(buf[:n]))
+
+	_, err = ln.WriteToUDP([]byte("world\n"), rAddr)
+	assert.NoError(t, err)
+
+	n, _, err = ln.ReadFromUDP(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "got world\n", string(buf[:n]))
+
+	time.Sleep(100 * time.Millisecond)
+
+	expected := `msg="starting UDP client"
+msg="command exited"
+msg="stopping UDP client"
+msg="UDP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUDPClientQuitAfterEOF(t *testing.T) {
+	lAddr, err := net.ResolveUDPAddr("udp", "localhost:7013")
+	assert.NoError(t, err)
+	ln, err := net.ListenUDP("udp", lAddr)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{quitDelay: 0},
+		logger: logger,
+	}
+
+	client := app.NewUDPClient("localhost:7013")
+	done := make(chan struct{})
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	client.sendch <- []byte("last datagram\n")
+	client.sendch <- nil
+
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := ln.ReadFromUDP(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "last datagram\n", string(buf[:n]))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("client did not quit after the end of the input")
+	}
+
+	expected := `msg="starting UDP client"
+msg="sending message to server"
+msg="stopping UDP client"
+msg="UDP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUDPClientConcurrentStop(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{config: config{}, logger: logger}
+
+	client := app.NewUDPClient("127.0.0.1:7020")
+	done := make(chan struct{})
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.stopUDPClient()
+		}()
+	}
+	wg.Wait()
+	<-done
+
+	expected := `msg="starting UDP client"
+msg="stopping UDP client"
+msg="UDP client shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUDPClientSourcePort(t *testing.T) {
+	lAddr, err := net.ResolveUDPAddr("udp", "127.0.0.1:7015")
+	assert.NoError(t, err)
+	ln, err := net.ListenUDP("udp", lAddr)
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	logger, _ := createTestSlog()
+	app := &application{
+		config: config{source: "127.0.0.1", port: 7016},
+		logger: logger,
+	}
+
+	client := app.NewUDPClient("127.0.0.1:7015")
+	go func() {
+		err := client.StartUDPClient()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	client.sendch <- []byte("from a fixed port\n")
+
+	buf := make([]byte, 1024)
+	ln.SetReadDeadline(time.Now().Add(time.Second))
+	_, rAddr, err := ln.ReadFromUDP(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:7016", rAddr.String())
+
+	client.stopUDPClient()
+}
@@ -4,27 +4,47 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 )
 
 type UDPServer struct {
 	bytesRcvd int
 	bytesSent int
 	config    config
-	conn      *net.UDPConn
-	lAddr     *net.UDPAddr
-	rAddr     *net.UDPAddr
+	conn      net.Conn
+	ln        net.PacketConn
+	lAddr     net.Addr
+	rAddr     net.Addr
 	quit      chan interface{}
-	sendch    chan string
+	sendch    chan []byte
 	logger    *slog.Logger
+	mu        sync.Mutex
+	peers     map[string]*udpPeer
+	lastPeer  *udpPeer
+	waitErr   error
+}
+
+// udpPeer is a session with a remote address in keep-open mode. It expires
+// after receiving nothing for longer than the configured peer timeout. In
+// relay mode each peer has its own upstream connection to the relay target.
+type udpPeer struct {
+	addr      net.Addr
+	bytesRcvd int
+	bytesSent int
+	lastSeen  time.Time
+	target    string
+	upstream  io.ReadWriteCloser
 }
 
 func (app *application) NewUDPServer(addr string) *UDPServer {
-	lAddr, err := net.ResolveUDPAddr("udp", addr)
+	lAddr, err := resolvePacketAddr(app.config.network("udp"), addr)
 	if err != nil {
 		app.logger.Error("failed to resolve local UDP address", "addr", addr, "error", err)
 		os.Exit(1)
@@ -34,33 +54,51 @@ func (app *application) NewUDPServer(addr string) *UDPServer {
 		config: app.config,
 		lAddr:  lAddr,
 		logger: app.logger,
+		peers:  make(map[string]*udpPeer),
 		quit:   make(chan interface{}),
-		sendch: make(chan string),
+		sendch: make(chan []byte),
 	}
 }
 
 func (srv *UDPServer) StartUDP() error {
-	ln, err := net.ListenUDP("udp", srv.lAddr)
+	ln, err := net.ListenPacket(srv.config.network("udp"), srv.lAddr.String())
 	if err != nil {
 		return err
 	}
+	srv.ln = ln
 	srv.logger.Info("starting UDP server", "addr", srv.lAddr)
 
 	if srv.config.verbose {
-		fmt.Printf("Listening on [any] %d ...\n", srv.config.port)
+		fmt.Printf("Listening on %s ...\n", formatListenAddr(ln.LocalAddr()))
 	}
 
 	go srv.stopOsSignal()
 
-	rAddr, err := srv.getRemoteAddr(ln)
+	if srv.config.keepOpen {
+		go srv.readUDPPeers(ln)
+		if !srv.config.executes() {
+			go srv.writeUDPPeers(ln)
+		}
+		if srv.config.peerTimeout > 0 {
+			go srv.expireUDPPeers()
+		}
+
+		<-srv.quit
+		srv.logger.Info("UDP server shutdown successfully")
+		return srv.waitErr
+	}
+
+	rAddr, first, err := srv.getRemoteAddr(ln)
 	if err != nil {
+		if isTimeout(err) {
+			err = srv.waitTimedOut(err)
+		}
 		return err
 	}
 
 	srv.rAddr = rAddr
-	ln.Close()
 
-	go srv.handleUDPConnection()
+	go srv.handleUDPConnection(ln, first)
 
 	<-srv.quit
 	srv.logger.Info("UDP server shutdown successfully")
@@ -68,36 +106,101 @@ func (srv *UDPServer) StartUDP() error {
 }
 
 func (srv *UDPServer) stopUDP() {
-	if srv.config.verbose {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	select {
+	case <-srv.quit:
+		return
+	default:
+	}
+
+	if srv.config.verbose && !srv.config.executes() {
 		fmt.Printf(" sent %d, rcvd %d\n", srv.bytesSent, srv.bytesRcvd)
 	}
 	srv.logger.Info("stopping UDP server")
 	close(srv.quit)
-	close(srv.sendch)
 	if srv.conn != nil {
 		srv.conn.Close()
 	}
+	if srv.ln != nil {
+		srv.ln.Close()
+		removeSocketFile(srv.lAddr)
+	}
+	for _, p := range srv.peers {
+		if p.upstream != nil {
+			p.upstream.Close()
+		}
+	}
 }
 
-func (srv *UDPServer) handleUDPConnection() {
-	conn, err := net.DialUDP("udp", srv.lAddr, srv.rAddr)
-	if err != nil {
-		srv.logger.Error("failed to dial UDP connection", "lAddr", srv.lAddr.String(), "rAddr", srv.rAddr.String(), "error", err)
-		return
+// handleUDPConnection talks to the peer of the first datagram. When running
+// a process, that datagram is the first input of the process.
+func (srv *UDPServer) handleUDPConnection(ln net.PacketConn, first []byte) {
+	var conn net.Conn
+	if network := srv.config.network("udp"); network == "unixgram" {
+		// A Unix datagram client is connected to the listening socket and
+		// refuses any other peer, so keep talking through it.
+		conn = &peerConn{PacketConn: ln, rAddr: srv.rAddr}
+	} else {
+		ln.Close()
+		d := net.Dialer{LocalAddr: srv.lAddr}
+		c, err := d.Dial(network, srv.rAddr.String())
+		if err != nil {
+			srv.logger.Error("failed to dial UDP connection", "lAddr", srv.lAddr.String(), "rAddr", srv.rAddr.String(), "error", err)
+			return
+		}
+		conn = c
 	}
+	conn = srv.config.idle(conn)
 	srv.conn = conn
 
+	if srv.config.executes() {
+		go srv.executeUDPCmd(&pendingConn{Conn: conn, pending: first})
+		return
+	}
 	go srv.readUDP(conn)
 	go srv.writeUDP(conn)
 }
 
-func (srv *UDPServer) getRemoteAddr(conn *net.UDPConn) (*net.UDPAddr, error) {
+// executeUDPCmd feeds the datagrams of the peer to the standard input of the
+// process and sends every chunk of its output back as a datagram.
+func (srv *UDPServer) executeUDPCmd(conn net.Conn) {
+	c, err := srv.config.command()
+	if err == nil {
+		c.Env = commandEnv(conn.LocalAddr(), conn.RemoteAddr())
+		err = srv.config.runCommand(c, conn)
+	}
+	srv.config.reportExit(srv.logger, c, err)
+	srv.stopUDP()
+}
+
+// waitTimedOut reports that no datagram came within the wait timeout of -w
+// and stops the server, which then returns the error.
+func (srv *UDPServer) waitTimedOut(err error) error {
+	srv.waitErr = fmt.Errorf("no datagram within %s: %w", srv.config.waitTimeout(), err)
+	srv.logger.Error("timed out waiting for a connection", "error", srv.waitErr)
+	if srv.config.verbose {
+		fmt.Printf("No connection within %s\n", srv.config.waitTimeout())
+	}
+	srv.stopUDP()
+	return srv.waitErr
+}
+
+func (srv *UDPServer) getRemoteAddr(conn net.PacketConn) (net.Addr, []byte, error) {
 	buf := make([]byte, 2048)
 	var dataRead []byte
 
-	n, rAddr, err := conn.ReadFromUDP(buf)
+	if srv.config.wait > 0 {
+		conn.SetReadDeadline(time.Now().Add(srv.config.waitTimeout()))
+	}
+	n, rAddr, err := conn.ReadFrom(buf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if rAddr == nil {
+		return nil, nil, errUnboundPeer
 	}
 	srv.bytesRcvd += n
 	dataRead = buf[:n]
@@ -105,30 +208,53 @@ func (srv *UDPServer) getRemoteAddr(conn *net.UDPConn) (*net.UDPAddr, error) {
 		fmt.Printf("Connection to [%s] from [%s] [%s]\n", conn.LocalAddr(), rAddr, rAddr.Network())
 	}
 	srv.logger.Info("received data from the client", "addr", rAddr, "byte", n)
-	fmt.Print(string(dataRead))
+	if !srv.config.executes() {
+		text := srv.config.received(dataRead, nil)
+		fmt.Print(string(text))
+		srv.config.capture.output(text)
+	}
+	srv.config.capture.dumpRecv(rAddr, dataRead)
 
-	return rAddr, nil
+	return rAddr, dataRead, nil
 }
 
-func (srv *UDPServer) readUDP(conn *net.UDPConn) {
+func (srv *UDPServer) readUDP(conn net.Conn) {
+	rAddr := conn.RemoteAddr()
 	buf := make([]byte, 2048)
 	var dataRead []byte
 
 	for {
-		n, rAddr, err := conn.ReadFromUDP(buf)
+		n, err := conn.Read(buf)
 		if err != nil {
-			if errors.Is(err, syscall.ECONNREFUSED) {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
 				fmt.Print("Connection refused: ")
 				srv.stopUDP()
 				return
 			}
-			srv.logger.Error("failed to read from UDP connection", "rAddr", rAddr, "error", err)
-			return
+			if isTimeout(err) {
+				srv.logger.Info("connection timed out", "rAddr", rAddr, "error", err)
+				if srv.config.verbose {
+					fmt.Printf("Connection from [%s] timed out\n", rAddr)
+				}
+				srv.stopUDP()
+				return
+			}
+
+			select {
+			case <-srv.quit:
+				return
+			default:
+				srv.logger.Error("failed to read from UDP connection", "rAddr", rAddr, "error", err)
+				return
+			}
 		}
 		srv.bytesRcvd += n
 		dataRead = buf[:n]
 		srv.logger.Info("received data from the client", "addr", rAddr, "byte", n)
-		fmt.Print(string(dataRead))
+		text := srv.config.received(dataRead, nil)
+		fmt.Print(string(text))
+		srv.config.capture.output(text)
+		srv.config.capture.dumpRecv(rAddr, dataRead)
 
 		if srv.config.hex {
 			fmt.Printf("Received %d bytes from the socket\n", n)
@@ -141,11 +267,22 @@ func (srv *UDPServer) readUDP(conn *net.UDPConn) {
 	}
 }
 
-func (srv *UDPServer) writeUDP(conn *net.UDPConn) {
-	for msg := range srv.sendch {
-		n, err := conn.Write([]byte(msg))
+func (srv *UDPServer) writeUDP(conn net.Conn) {
+	for {
+		var msg []byte
+		select {
+		case msg = <-srv.sendch:
+		case <-srv.quit:
+			return
+		}
+		if msg == nil {
+			srv.config.quitAfterInput(srv.stopUDP)
+			continue
+		}
+
+		n, err := conn.Write(msg)
 		if err != nil {
-			if errors.Is(err, syscall.ECONNREFUSED) {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
 				fmt.Print("Connection refused: ")
 				srv.stopUDP()
 				return
@@ -155,13 +292,325 @@ func (srv *UDPServer) writeUDP(conn *net.UDPConn) {
 		}
 		srv.bytesSent += n
 		srv.logger.Info("sending message to client", "remoteAddr", conn.RemoteAddr())
+		srv.config.capture.dumpSent(conn.RemoteAddr(), msg)
 		if srv.config.hex {
 			fmt.Printf("Sent %d bytes to the socket\n", n)
-			fmt.Printf("%s", hex.Dump([]byte(msg)))
+			fmt.Printf("%s", hex.Dump(msg))
 		}
 	}
 }
 
+// readUDPPeers reads datagrams from every peer on the listening socket,
+// tagging the printed data with the peer it came from.
+func (srv *UDPServer) readUDPPeers(ln net.PacketConn) {
+	buf := make([]byte, 2048)
+	var dataRead []byte
+
+	// Only the first datagram has to come within the wait timeout.
+	waiting := srv.config.wait > 0
+	if waiting {
+		ln.SetReadDeadline(time.Now().Add(srv.config.waitTimeout()))
+	}
+
+	for {
+		n, rAddr, err := ln.ReadFrom(buf)
+		if err != nil {
+			if waiting && isTimeout(err) {
+				srv.waitTimedOut(err)
+				return
+			}
+			select {
+			case <-srv.quit:
+			default:
+				srv.logger.Error("failed to read from UDP connection", "error", err)
+				srv.stopUDP()
+			}
+			return
+		}
+		if waiting {
+			waiting = false
+			ln.SetReadDeadline(time.Time{})
+		}
+		dataRead = buf[:n]
+		if rAddr == nil {
+			srv.logger.Error("failed to read from UDP connection", "error", errUnboundPeer)
+			continue
+		}
+
+		srv.mu.Lock()
+		p, ok := srv.peers[rAddr.String()]
+		srv.mu.Unlock()
+		if !ok {
+			if p, err = srv.addUDPPeer(ln, rAddr); err != nil {
+				select {
+				case <-srv.quit:
+					return
+				default:
+				}
+				srv.logger.Error("failed to connect to relay target", "target", srv.config.relay, "error", err)
+				continue
+			}
+		}
+
+		srv.mu.Lock()
+		p.bytesRcvd += n
+		p.lastSeen = time.Now()
+		srv.bytesRcvd += n
+		srv.lastPeer = p
+		srv.mu.Unlock()
+
+		srv.logger.Info("received data from the client", "addr", rAddr, "byte", n)
+		srv.config.capture.dumpRecv(rAddr, dataRead)
+		if p.upstream != nil {
+			if srv.config.crlf && srv.config.relay != "" {
+				var cr bool
+				dataRead = addCR(dataRead, &cr)
+			}
+			if _, err := p.upstream.Write(dataRead); err != nil {
+				srv.logger.Error("failed to write to relay target", "target", p.target, "error", err)
+				continue
+			}
+			srv.config.capture.dumpSent(p.target, dataRead)
+			if srv.config.hex {
+				fmt.Printf("Relayed %d bytes from [%s] to [%s]\n%s", n, rAddr, p.target, hex.Dump(dataRead))
+			}
+			continue
+		}
+		text := srv.config.received(dataRead, nil)
+		fmt.Printf("[%s] %s", rAddr, text)
+		srv.config.capture.output(text)
+
+		if srv.config.hex {
+			fmt.Printf("Received %d bytes from [%s]\n", n, rAddr)
+			fmt.Printf("%s", hex.Dump(dataRead))
+		}
+	}
+}
+
+// writeUDPPeers sends every message read from the standard input to the
+// peer that sent the last datagram, or to every known peer in reply-all mode.
+func (srv *UDPServer) writeUDPPeers(ln net.PacketConn) {
+	for {
+		var msg []byte
+		select {
+		case msg = <-srv.sendch:
+		case <-srv.quit:
+			return
+		}
+		if msg == nil {
+			srv.config.quitAfterInput(srv.stopUDP)
+			continue
+		}
+
+		srv.mu.Lock()
+		var targets []*udpPeer
+		if srv.config.replyAll {
+			for _, p := range srv.peers {
+				targets = append(targets, p)
+			}
+		} else if srv.lastPeer != nil {
+			targets = append(targets, srv.lastPeer)
+		}
+
+		if len(targets) == 0 {
+			srv.logger.Info("no UDP peer to send the message to")
+		}
+		for _, p := range targets {
+			n, err := ln.WriteTo(msg, p.addr)
+			if err != nil {
+				srv.logger.Error("failed to write to UDP connection", "rAddr", p.addr, "error", err)
+				continue
+			}
+			p.bytesSent += n
+			srv.bytesSent += n
+			srv.logger.Info("sending message to client", "remoteAddr", p.addr)
+			srv.config.capture.dumpSent(p.addr, msg)
+			if srv.config.hex {
+				fmt.Printf("Sent %d bytes to [%s]\n", n, p.addr)
+				fmt.Printf("%s", hex.Dump(msg))
+			}
+		}
+		srv.mu.Unlock()
+	}
+}
+
+// minExpiryInterval keeps the expiry ticker running at a sane rate however
+// short the peer timeout is.
+const minExpiryInterval = 10 * time.Millisecond
+
+// expireUDPPeers drops the peers that have been idle for longer than the
+// peer timeout.
+func (srv *UDPServer) expireUDPPeers() {
+	ticker := time.NewTicker(max(srv.config.peerTimeout/2, minExpiryInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-srv.quit:
+			return
+		case now := <-ticker.C:
+			srv.mu.Lock()
+			for key, p := range srv.peers {
+				if now.Sub(p.lastSeen) < srv.config.peerTimeout {
+					continue
+				}
+				delete(srv.peers, key)
+				if srv.lastPeer == p {
+					srv.lastPeer = nil
+				}
+				if p.upstream != nil {
+					p.upstream.Close()
+				}
+				srv.logger.Info("UDP peer expired", "addr", p.addr)
+				if srv.config.verbose {
+					fmt.Printf("Connection from [%s] expired: sent %d, rcvd %d\n", p.addr, p.bytesSent, p.bytesRcvd)
+				}
+			}
+			srv.mu.Unlock()
+		}
+	}
+}
+
+// addUDPPeer starts the session of a new peer. Its upstream is opened
+// without holding the lock, since dialing the relay target or starting a
+// process may take a while and the other peers must not wait for it.
+func (srv *UDPServer) addUDPPeer(ln net.PacketConn, rAddr net.Addr) (*udpPeer, error) {
+	p := &udpPeer{addr: rAddr}
+	if srv.config.relay != "" || srv.config.executes() {
+		if err := srv.openRelay(p); err != nil {
+			return nil, err
+		}
+	}
+
+	srv.mu.Lock()
+	select {
+	case <-srv.quit:
+		srv.mu.Unlock()
+		if p.upstream != nil {
+			p.upstream.Close()
+		}
+		return nil, net.ErrClosed
+	default:
+	}
+	if existing, ok := srv.peers[rAddr.String()]; ok {
+		srv.mu.Unlock()
+		if p.upstream != nil {
+			p.upstream.Close()
+		}
+		return existing, nil
+	}
+	srv.peers[rAddr.String()] = p
+	srv.mu.Unlock()
+
+	if p.upstream != nil {
+		go srv.relayUDPPeer(ln, p)
+	}
+	srv.logger.Info("new UDP peer", "addr", rAddr)
+	if srv.config.verbose {
+		fmt.Printf("Connection to [%s] from [%s] [%s]\n", ln.LocalAddr(), rAddr, rAddr.Network())
+	}
+	return p, nil
+}
+
+// openRelay opens the upstream stream of a new peer on the relay target, or
+// starts a process for the peer when running one.
+func (srv *UDPServer) openRelay(p *udpPeer) error {
+	var ep endpoint
+	if srv.config.executes() {
+		e := srv.config.commandEndpoint()
+		e.env = commandEnv(srv.ln.LocalAddr(), p.addr)
+		ep = e
+	} else {
+		var err error
+		if ep, err = srv.config.relayEndpoint("udp"); err != nil {
+			return err
+		}
+	}
+	upstream, err := ep.open()
+	if err != nil {
+		return err
+	}
+	p.upstream = upstream
+	p.target = streamName(upstream, ep)
+	return nil
+}
+
+// relayUDPPeer sends the datagrams the relay target answers to a peer back
+// to that peer, until the upstream connection of the peer is closed.
+func (srv *UDPServer) relayUDPPeer(ln net.PacketConn, p *udpPeer) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := p.upstream.Read(buf)
+		if err != nil {
+			// A refused datagram only means the target is not listening yet.
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				srv.logger.Error("relay target refused the datagram", "target", p.target)
+				continue
+			}
+			// A process closing its output is about to exit; give it a
+			// moment so that its exit status is the one it chose.
+			if e, ok := p.upstream.(*execStream); ok {
+				select {
+				case <-e.exited:
+				case <-time.After(drainTimeout):
+				}
+			}
+			srv.closePeer(p)
+			return
+		}
+
+		srv.config.capture.dumpRecv(p.target, buf[:n])
+		data := buf[:n]
+		if srv.config.relay != "" {
+			data = srv.config.received(data, nil)
+		}
+		if _, err := ln.WriteTo(data, p.addr); err != nil {
+			srv.logger.Error("failed to write to UDP connection", "rAddr", p.addr, "error", err)
+			continue
+		}
+		srv.mu.Lock()
+		p.bytesSent += n
+		srv.bytesSent += n
+		srv.mu.Unlock()
+
+		srv.logger.Info("relayed data to the client", "addr", p.addr, "byte", n)
+		srv.config.capture.dumpSent(p.addr, data)
+		if srv.config.hex {
+			fmt.Printf("Relayed %d bytes from [%s] to [%s]\n%s", n, p.target, p.addr, hex.Dump(buf[:n]))
+		}
+	}
+}
+
+// closePeer forgets a peer whose upstream stream has ended, such as a peer
+// whose process exited. Its next datagram opens a new stream.
+func (srv *UDPServer) closePeer(p *udpPeer) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	select {
+	case <-srv.quit:
+		return
+	default:
+	}
+
+	key := p.addr.String()
+	if srv.peers[key] != p {
+		return
+	}
+	delete(srv.peers, key)
+	if srv.lastPeer == p {
+		srv.lastPeer = nil
+	}
+	p.upstream.Close()
+	if e, ok := p.upstream.(*execStream); ok {
+		srv.config.reportExit(srv.logger, e.cmd, nil, "addr", p.addr)
+	}
+	srv.logger.Info("UDP peer closed", "addr", p.addr)
+	if srv.config.verbose {
+		fmt.Printf("Connection from [%s] closed: sent %d, rcvd %d\n", p.addr, p.bytesSent, p.bytesRcvd)
+	}
+}
+
 func (srv *UDPServer) stopOsSignal() {
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
@@ -169,3 +618,30 @@ func (srv *UDPServer) stopOsSignal() {
 	srv.logger.Info("received operating system signal", "sig", s)
 	srv.stopUDP()
 }
+
+// peerConn is a net.Conn exchanging datagrams with a single peer over an
+// unconnected socket. Datagrams from any other address are dropped.
+type peerConn struct {
+	net.PacketConn
+	rAddr net.Addr
+}
+
+func (c *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+		if addr != nil && addr.String() == c.rAddr.String() {
+			return n, nil
+		}
+	}
+}
+
+func (c *peerConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.rAddr)
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.rAddr
+}
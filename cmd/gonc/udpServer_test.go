@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -42,7 +44,7 @@ func TestUDPMessaging(t *testing.T) {
 		fmt.Fprintln(clientConn, "Hello from the client")
 		time.Sleep(50 * time.Millisecond)
 		msg := "Hello from the server\n"
-		srv.sendch <- msg
+		srv.sendch <- []byte(msg)
 
 		buf := make([]byte, 1024)
 		n, err := clientConn.Read(buf)
@@ -97,7 +99,7 @@ func TestUDPShutdownOnSendFail(t *testing.T) {
 		clientConn.Close()
 		time.Sleep(50 * time.Millisecond)
 		msg := "Hello from the server\n"
-		srv.sendch <- msg
+		srv.sendch <- []byte(msg)
 	}()
 
 	wg.Wait()
@@ -155,3 +157,439 @@ msg="received data from the client"
 `
 	assert.Equal(t, expected, logBuf.String())
 }
+
+func TestUDPKeepOpenPeers(t *testing.T) {
+	tests := []struct {
+		name     string
+		replyAll bool
+		expected []string
+	}{
+		{
+			name:     "Reply To Last Peer",
+			replyAll: false,
+			expected: []string{"", "Hello from the server\n"},
+		},
+		{
+			name:     "Reply To All Peers",
+			replyAll: true,
+			expected: []string{"Hello from the server\n", "Hello from the server\n"},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+
+			logger, logBuf := createTestSlog()
+
+			port := 7004 + i
+			app := &application{
+				config: config{verbose: true, keepOpen: true, replyAll: tt.replyAll, port: port},
+				logger: logger,
+			}
+
+			addr := fmt.Sprintf(":%d", port)
+			srv := app.NewUDPServer(addr)
+			go func() {
+				err := srv.StartUDP()
+				assert.NoError(t, err)
+			}()
+
+			var actual []string
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(50 * time.Millisecond)
+
+				var conns []net.Conn
+				for _, msg := range []string{"Hello from the 1st client", "Hello from the 2nd client"} {
+					conn, err := net.Dial("udp", addr)
+					assert.NoError(t, err)
+					fmt.Fprintln(conn, msg)
+					conns = append(conns, conn)
+					time.Sleep(50 * time.Millisecond)
+				}
+
+				srv.sendch <- []byte("Hello from the server\n")
+
+				for _, conn := range conns {
+					buf := make([]byte, 1024)
+					conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+					n, _ := conn.Read(buf)
+					actual = append(actual, string(buf[:n]))
+					conn.Close()
+				}
+
+				srv.stopUDP()
+			}()
+
+			wg.Wait()
+			time.Sleep(250 * time.Millisecond)
+
+			sends := "msg=\"sending message to client\"\n"
+			if tt.replyAll {
+				sends += sends
+			}
+			expected := `msg="starting UDP server"
+msg="new UDP peer"
+msg="received data from the client"
+msg="new UDP peer"
+msg="received data from the client"
+` + sends + `msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+			assert.Equal(t, expected, logBuf.String())
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestUDPPeerExpiry(t *testing.T) {
+	var wg sync.WaitGroup
+
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{keepOpen: true, peerTimeout: 100 * time.Millisecond, port: 7006},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer(":7006")
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		conn, err := net.Dial("udp", ":7006")
+		assert.NoError(t, err)
+		fmt.Fprintln(conn, "Hello from the client")
+		conn.Close()
+
+		time.Sleep(300 * time.Millisecond)
+		srv.sendch <- []byte("Hello from the server\n")
+		time.Sleep(50 * time.Millisecond)
+		srv.stopUDP()
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="new UDP peer"
+msg="received data from the client"
+msg="UDP peer expired"
+msg="no UDP peer to send the message to"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUDPPeerExpiryShortTimeout(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, peerTimeout: time.Nanosecond, port: 7017},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer(":7017")
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("udp", ":7017")
+	assert.NoError(t, err)
+	fmt.Fprintln(conn, "Hello from the client")
+	conn.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	srv.stopUDP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="new UDP peer"
+msg="received data from the client"
+msg="UDP peer expired"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+}
+
+func TestUnixDatagramSocket(t *testing.T) {
+	var wg sync.WaitGroup
+
+	path := filepath.Join(t.TempDir(), "gonc.sock")
+	logger, logBuf := createTestSlog()
+
+	app := &application{
+		config: config{unix: true},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer(path)
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+
+	clientLogger, _ := createTestSlog()
+	clientApp := &application{
+		config: config{unix: true},
+		logger: clientLogger,
+	}
+
+	client := clientApp.NewUDPClient(path)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		go func() {
+			err := client.StartUDPClient()
+			assert.NoError(t, err)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		client.sendch <- []byte("Hello from the client\n")
+		time.Sleep(50 * time.Millisecond)
+		srv.sendch <- []byte("Hello from the server\n")
+		time.Sleep(50 * time.Millisecond)
+		client.stopUDPClient()
+
+		time.Sleep(50 * time.Millisecond)
+		srv.sendch <- []byte("Hello again from the server\n")
+	}()
+
+	wg.Wait()
+	time.Sleep(250 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="received data from the client"
+msg="sending message to client"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, 22, client.bytesRcvd)
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "expected the socket file to be removed")
+	_, err = os.Stat(client.conn.LocalAddr().String())
+	assert.True(t, os.IsNotExist(err), "expected the client socket file to be removed")
+}
+
+func TestUDPRelay(t *testing.T) {
+	var wg sync.WaitGroup
+
+	target, err := net.ListenPacket("udp", "127.0.0.1:7008")
+	assert.NoError(t, err)
+	defer target.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := target.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			target.WriteTo(append([]byte("echo: "), buf[:n]...), addr)
+		}
+	}()
+
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, relay: "127.0.0.1:7008"},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer("127.0.0.1:7007")
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+
+	var actual []string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(50 * time.Millisecond)
+
+		for _, msg := range []string{"1st client\n", "2nd client\n"} {
+			conn, err := net.Dial("udp", "127.0.0.1:7007")
+			assert.NoError(t, err)
+			fmt.Fprint(conn, msg)
+
+			buf := make([]byte, 1024)
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := conn.Read(buf)
+			assert.NoError(t, err)
+			actual = append(actual, string(buf[:n]))
+			conn.Close()
+		}
+	}()
+
+	wg.Wait()
+
+	srv.mu.Lock()
+	for _, p := range srv.peers {
+		assert.Equal(t, 11, p.bytesRcvd)
+		assert.Equal(t, 17, p.bytesSent)
+	}
+	srv.mu.Unlock()
+
+	srv.stopUDP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="new UDP peer"
+msg="received data from the client"
+msg="relayed data to the client"
+msg="new UDP peer"
+msg="received data from the client"
+msg="relayed data to the client"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"echo: 1st client\n", "echo: 2nd client\n"}, actual)
+}
+
+func TestUDPExecuteCmd(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{cmd: "/bin/cat -n"},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer("127.0.0.1:7011")
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn, err := net.Dial("udp", "127.0.0.1:7011")
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	var actual []string
+	buf := make([]byte, 1024)
+	for _, msg := range []string{"1st datagram\n", "2nd datagram\n"} {
+		fmt.Fprint(conn, msg)
+		n, err := conn.Read(buf)
+		assert.NoError(t, err)
+		actual = append(actual, string(buf[:n]))
+	}
+
+	srv.stopUDP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="received data from the client"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+msg="command exited"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"     1\t1st datagram\n", "     2\t2nd datagram\n"}, actual)
+}
+
+func TestUDPKeepOpenExecuteCmd(t *testing.T) {
+	logger, logBuf := createTestSlog()
+	app := &application{
+		config: config{keepOpen: true, shExec: `read line; echo "got $line"`},
+		logger: logger,
+	}
+
+	srv := app.NewUDPServer("127.0.0.1:7012")
+	go func() {
+		err := srv.StartUDP()
+		assert.NoError(t, err)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var actual []string
+	buf := make([]byte, 1024)
+	for _, msg := range []string{"1st client\n", "2nd client\n"} {
+		conn, err := net.Dial("udp", "127.0.0.1:7012")
+		assert.NoError(t, err)
+		fmt.Fprint(conn, msg)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		assert.NoError(t, err)
+		actual = append(actual, string(buf[:n]))
+		conn.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	srv.stopUDP()
+	time.Sleep(50 * time.Millisecond)
+
+	expected := `msg="starting UDP server"
+msg="new UDP peer"
+msg="received data from the client"
+msg="relayed data to the client"
+msg="command exited"
+msg="UDP peer closed"
+msg="new UDP peer"
+msg="received data from the client"
+msg="relayed data to the client"
+msg="command exited"
+msg="UDP peer closed"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`
+	assert.Equal(t, expected, logBuf.String())
+	assert.Equal(t, []string{"got 1st client\n", "got 2nd client\n"}, actual)
+}
+
+func TestUDPServerWaitTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   config
+		addr     string
+		expected string
+	}{
+		{
+			name:   "Single Peer",
+			config: config{wait: 1},
+			addr:   "127.0.0.1:7014",
+			expected: `msg="starting UDP server"
+msg="timed out waiting for a connection" error="no datagram within 1s: read udp 127.0.0.1:7014: i/o timeout"
+msg="stopping UDP server"
+`,
+		},
+		{
+			name:   "Keep Open",
+			config: config{keepOpen: true, wait: 1},
+			addr:   "127.0.0.1:7019",
+			expected: `msg="starting UDP server"
+msg="timed out waiting for a connection" error="no datagram within 1s: read udp 127.0.0.1:7019: i/o timeout"
+msg="stopping UDP server"
+msg="UDP server shutdown successfully"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logBuf := createTestSlog()
+			app := &application{config: tt.config, logger: logger}
+
+			srv := app.NewUDPServer(tt.addr)
+			err := srv.StartUDP()
+			assert.True(t, isTimeout(err))
+			assert.Equal(t, tt.expected, logBuf.String())
+		})
+	}
+}